@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"text/tabwriter"
+	"time"
+	"wifigo/pkg"
+)
+
+// Usage of the management commands
+const (
+	kickUsage    = "usage: wifigo -cmd kick [-ban | -disassoc] [-reason N] <iface> <mac>"
+	unbanUsage   = "usage: wifigo -cmd unban <iface> <mac>"
+	bansUsage    = "usage: wifigo -cmd bans <iface>"
+	clientsUsage = "usage: wifigo -cmd clients <iface>"
+)
+
+// runCommand runs a management command against a running AP, like
+// "wifigo -cmd kick wlan0 aa:bb:cc:dd:ee:ff". Commands need the leading
+// -cmd flag so any SSID still works with "wifigo <ssid> <password>". It
+// returns false when args is not a command, so main starts the AP instead.
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 || (args[0] != "-cmd" && args[0] != "--cmd") {
+		return false, nil
+	}
+	if len(args) < 2 {
+		return true, errors.New("usage: wifigo -cmd <kick|unban|bans|clients> ...")
+	}
+
+	var err error
+	switch args[1] {
+	case "kick":
+		err = kickCommand(args[2:])
+	case "unban":
+		err = unbanCommand(args[2:])
+	case "bans":
+		err = bansCommand(args[2:])
+	case "clients":
+		err = clientsCommand(args[2:])
+	default:
+		return true, fmt.Errorf("unknown command %q, use kick, unban, bans or clients", args[1])
+	}
+	// -h printed the usage already
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return true, nil
+	}
+	return true, fmt.Errorf("%s: %v", args[1], err)
+}
+
+// kickCommand: kick [-ban | -disassoc] [-reason N] <iface> <mac>
+func kickCommand(args []string) error {
+	fs := flag.NewFlagSet("kick", flag.ContinueOnError)
+	ban := fs.Bool("ban", false, "also add the client to the deny list (survives restarts)")
+	disassoc := fs.Bool("disassoc", false, "disassociate instead of deauthenticate")
+	reason := fs.Int("reason", pkg.ReasonUnspecified, "802.11 reason code sent to the client")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, kickUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// hostapd deauthenticates a denied client, it can't be disassociated
+	if *ban && *disassoc {
+		return fmt.Errorf("-ban and -disassoc can't be combined, a banned client is deauthenticated")
+	}
+
+	iface, mac, err := ifaceAndMAC(fs, kickUsage)
+	if err != nil {
+		return err
+	}
+
+	if *ban {
+		if err := pkg.BanClient(iface, mac, *reason); err != nil {
+			return err
+		}
+		fmt.Printf("Banned %s on %s\n", mac, iface)
+		return nil
+	}
+	if err := pkg.KickClient(iface, mac, *reason, *disassoc); err != nil {
+		return err
+	}
+	fmt.Printf("Kicked %s from %s\n", mac, iface)
+	return nil
+}
+
+// unbanCommand: unban <iface> <mac>
+func unbanCommand(args []string) error {
+	fs := flag.NewFlagSet("unban", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, unbanUsage) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	iface, mac, err := ifaceAndMAC(fs, unbanUsage)
+	if err != nil {
+		return err
+	}
+	if err := pkg.UnbanClient(iface, mac); err != nil {
+		return err
+	}
+	fmt.Printf("Unbanned %s on %s\n", mac, iface)
+	return nil
+}
+
+// bansCommand: bans <iface>
+func bansCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New(bansUsage)
+	}
+	macs, err := pkg.BannedClients(args[0])
+	if err != nil {
+		return err
+	}
+	for _, mac := range macs {
+		fmt.Println(mac)
+	}
+	return nil
+}
+
+// clientsCommand: clients <iface>
+func clientsCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New(clientsUsage)
+	}
+	clients, err := pkg.Clients(args[0])
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MAC\tIP\tHOSTNAME\tBSS\tSIGNAL\tTX/RX RATE\tTX/RX BYTES\tCONNECTED\tLEASE")
+	for _, c := range clients {
+		ip, hostname, lease := "-", "-", "-"
+		if c.Lease != nil {
+			ip = c.Lease.IP.String()
+			if c.Lease.Hostname != "" {
+				hostname = c.Lease.Hostname
+			}
+			lease = "infinite"
+			if !c.Lease.Expiry.IsZero() {
+				lease = time.Until(c.Lease.Expiry).Truncate(time.Second).String()
+			}
+		}
+		bss, signal, rate, bytes, connected := "-", "-", "-", "-", "disconnected"
+		if c.Associated {
+			bss = c.Ifname
+			signal = fmt.Sprintf("%d dBm", c.Signal)
+			rate = fmt.Sprintf("%.1f/%.1f Mbit/s", float64(c.TxBitrate)/1e6, float64(c.RxBitrate)/1e6)
+			bytes = fmt.Sprintf("%d/%d", c.TxBytes, c.RxBytes)
+			connected = c.Connected.Truncate(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.MAC, ip, hostname, bss, signal, rate, bytes, connected, lease)
+	}
+	return w.Flush()
+}
+
+// ifaceAndMAC returns the <iface> <mac> arguments left after the flags
+func ifaceAndMAC(fs *flag.FlagSet, usage string) (string, net.HardwareAddr, error) {
+	if fs.NArg() != 2 {
+		return "", nil, errors.New(usage)
+	}
+	mac, err := net.ParseMAC(fs.Arg(1))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid MAC address %q", fs.Arg(1))
+	}
+	return fs.Arg(0), mac, nil
+}
@@ -4,8 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/netip"
 	"os"
-	"time"
 	"wifigo/pkg"
 
 	"github.com/mdlayher/wifi"
@@ -41,6 +42,17 @@ func GetWifi() []WInterface {
 }
 
 func main() {
+	// Management commands (-cmd kick, unban, bans, clients) talk to an AP that is already running
+	if ok, err := runCommand(os.Args[1:]); ok {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// hostapd and dnsmasq output is logged as structured records, pick the handler here
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
 
 	wInterfaces := GetWifi()
 	if len(wInterfaces) == 0 {
@@ -65,9 +77,6 @@ func main() {
 		log.Fatalf("Failed to reset interface: %v", err)
 	}
 
-	// Wait a moment for interface to stabilize
-	time.Sleep(1 * time.Second)
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -75,40 +84,49 @@ func main() {
 	wifiConfig := &pkg.WifiConfig{
 		Standard: pkg.Wifi6, // Options: Wifi4, Wifi5, Wifi6, Wifi7
 		// Band and Channel are optional - auto-configured if not specified
-		Band: "5", // Optional: "2.4" or "5" GHz
-		// Channel: 36,       // Optional: auto-selected if 0 or omitted
-	}
-
-	cmdHostapd, err := pkg.StartHostapd(ctx, targetIface.Name, "192.168.107.1/24", sSID, password, wifiConfig)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "start hostapd:", err)
-		os.Exit(1)
+		Band: "5", // Optional: "2.4", "5" or "6" GHz (6 GHz needs Wifi6/Wifi7 and WPA3 or OWE)
+		// Channel: 36,       // Optional: least congested channel is picked from a scan if 0 or omitted
+		// Width: 80,         // Optional: 20, 40, 80 or 160 MHz
+		// Security: pkg.WPA2WPA3, // Optional: WPA2PSK (default), WPA3SAE, WPA2WPA3, SecurityOpen, OWE, OWETransition (open modes need an empty password)
+		// Country: "DE",     // Optional: regulatory country code, US if empty
+		// TxPower: 20,       // Optional: transmit power in dBm, checked against the country's limit
+		// DFSFallbackChannel: 36, // Optional: channel used when radar hits a DFS channel (52-144)
+		// BSS: []pkg.BSSConfig{ // Optional: more networks on the same radio
+		// 	{SSID: "guest", Password: "guestpass123", Isolate: true},
+		// },
 	}
 
-	// wait 2 seconds
-	time.Sleep(2 * time.Second)
-
 	iface := targetIface.Name
-	ip := "192.168.107.1"
 
-	cmdDnsmasq, err := pkg.StartDnsmasq(ctx, iface, ip)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "start dnsmasq:", err)
+	// DHCP pool of the clients, the address is the AP's own
+	dhcp := &pkg.DHCPConfig{
+		Prefix: netip.MustParsePrefix("192.168.107.1/24"),
+		// RangeStart: netip.MustParseAddr("192.168.107.10"), // Optional: first address after the gateway if omitted
+		// RangeEnd:   netip.MustParseAddr("192.168.107.200"), // Optional: last address before broadcast if omitted
+		// LeaseTime:  time.Hour, // Optional: 12h if omitted
+		// MaxLeases:  50,        // Optional: dnsmasq default if omitted
+		// Reservations: []pkg.DHCPReservation{ // Optional: fixed addresses, change at runtime with pkg.AddDHCPReservation
+		// 	{MAC: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}, IP: netip.MustParseAddr("192.168.107.5"), Hostname: "testrig"},
+		// },
+		// DNS: &pkg.DNSConfig{ // Optional: resolves from /etc/resolv.conf if omitted
+		// 	Domain:   "lan", // clients resolve each other as <hostname>.lan
+		// 	Hosts:    []pkg.DNSHost{{Name: "router", Addrs: []netip.Addr{netip.MustParseAddr("192.168.107.1")}}},
+		// 	Upstream: []netip.Addr{netip.MustParseAddr("1.1.1.1"), netip.MustParseAddr("9.9.9.9")},
+		// },
+	}
+	subnet := dhcp.Prefix.Masked().String()
+
+	// The supervisor restarts hostapd or dnsmasq when they crash and gives
+	// up when one keeps crashing. Start returns once both are ready.
+	sup := pkg.NewSupervisor(pkg.RestartPolicy{})
+	sup.SetLogger(logger)
+	sup.AddHostapd(iface, dhcp.Prefix.String(), sSID, password, wifiConfig)
+	sup.AddDnsmasq(iface, dhcp)
+	if err := sup.Start(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
-	// Wait until dnsmasq  or Hostapd exits or context is canceled
-	errChan := make(chan error, 2)
-	go func() {
-		errChan <- cmdHostapd.Wait()
-	}()
-	go func() {
-		errChan <- cmdDnsmasq.Wait()
-	}()
-
-	// wait 2 seconds
-	time.Sleep(2 * time.Second)
-
 	go func() {
 		fmt.Println("Press ENTER to stop...")
 		fmt.Scanln()
@@ -117,27 +135,22 @@ func main() {
 
 	_ = pkg.EnsureDnsmasqFirewall(ctx, iface, true)
 
-	_ = pkg.EnableNAT(ctx, "192.168.107.0/24")
+	_ = pkg.EnableNAT(ctx, subnet)
 
-	select {
-	case err = <-errChan:
-		// One of the commands exited
-		fmt.Println("dnsmasq  or Hostapd exits")
-	case <-ctx.Done():
+	// Wait until a service keeps crashing or the context is canceled, then stop both
+	err := sup.Wait()
+	if err != nil {
+		fmt.Println("dnsmasq  or Hostapd failed")
+	} else {
 		fmt.Println("Canceled")
-		// Context canceled
 	}
 
 	// Cleanup
 	fmt.Println("Cleaning up...")
 
-	// Stop services
-	pkg.StopCmd(cmdDnsmasq)
-	pkg.StopCmd(cmdHostapd)
-
 	// Remove NAT rules
 	fmt.Println("Removing NAT rules...")
-	if err := pkg.DisableNAT(context.Background(), "192.168.107.0/24"); err != nil {
+	if err := pkg.DisableNAT(context.Background(), subnet); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: failed to remove NAT rules: %v\n", err)
 	}
 
@@ -153,7 +166,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Warning: failed to re-enable Network Manager: %v\n", err)
 	}
 
-	if err != nil && ctx.Err() == nil {
+	if err != nil {
 		fmt.Fprintln(os.Stderr, "exited:", err)
 	}
 }
@@ -0,0 +1,236 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mdlayher/wifi"
+)
+
+// ChannelScore describes how congested a candidate channel is. Lower Score is better.
+type ChannelScore struct {
+	Channel   int
+	Frequency int     // MHz of the primary channel
+	BSSCount  int     // neighbouring BSSes overlapping the channel block
+	MaxSignal int     // strongest overlapping BSS in dBm, 0 if none
+	Busy      float64 // fraction of time the block was busy (survey), -1 if unknown
+	Noise     int     // highest noise floor in the block in dBm, 0 if unknown
+	Score     float64
+}
+
+func (c ChannelScore) String() string {
+	busy := "n/a"
+	if c.Busy >= 0 {
+		busy = fmt.Sprintf("%.0f%%", c.Busy*100)
+	}
+	return fmt.Sprintf("channel %d (%d MHz): score %.1f, %d BSS, strongest %d dBm, busy %s, noise %d dBm",
+		c.Channel, c.Frequency, c.Score, c.BSSCount, c.MaxSignal, busy, c.Noise)
+}
+
+// acsCandidates24 and acsCandidates5 are the channels auto-selection may pick.
+// DFS channels are skipped on 5 GHz because they need a CAC before use, on
+// 6 GHz only PSC channels are used (pscChannels6).
+var (
+	acsCandidates24 = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	acsCandidates5  = []int{36, 40, 44, 48, 149, 153, 157, 161, 165}
+)
+
+// scanTimeout bounds how long SelectChannel waits for scan results
+const scanTimeout = 10 * time.Second
+
+// channelToFreq returns the center frequency in MHz of a 20 MHz channel
+func channelToFreq(band string, channel int) int {
+	switch band {
+	case "2.4":
+		if channel == 14 {
+			return 2484
+		}
+		return 2407 + channel*5
+	case "5":
+		return 5000 + channel*5
+	case "6":
+		return 5950 + channel*5
+	}
+	return 0
+}
+
+// freqToChannel returns the band and channel number of a frequency in MHz
+func freqToChannel(freq int) (string, int) {
+	switch {
+	case freq == 2484:
+		return "2.4", 14
+	case freq >= 2412 && freq < 2484:
+		return "2.4", (freq - 2407) / 5
+	case freq >= 5150 && freq <= 5895:
+		return "5", (freq - 5000) / 5
+	case freq >= 5955 && freq <= 7115:
+		return "6", (freq - 5950) / 5
+	}
+	return "", 0
+}
+
+// SelectChannel scans on ifaceName, collects neighbouring BSSes and channel
+// survey data and picks the least congested channel for band and width.
+// The scores of every candidate are returned from best to worst so callers
+// can log why a channel was chosen.
+func SelectChannel(ctx context.Context, ifaceName, band string, width int) (int, []ChannelScore, error) {
+	c, err := wifi.New()
+	if err != nil {
+		return 0, nil, fmt.Errorf("error open connection wifi: %v", err)
+	}
+	defer c.Close()
+
+	ifaces, err := c.Interfaces()
+	if err != nil {
+		return 0, nil, fmt.Errorf("error listing interfaces: %v", err)
+	}
+	var ifi *wifi.Interface
+	for _, i := range ifaces {
+		if i.Name == ifaceName {
+			ifi = i
+			break
+		}
+	}
+	if ifi == nil {
+		return 0, nil, fmt.Errorf("interface not found %s", ifaceName)
+	}
+
+	// A failed scan is not fatal, the kernel may still have recent results
+	scanCtx, cancel := context.WithTimeout(ctx, scanTimeout)
+	if err := c.Scan(scanCtx, ifi); err != nil {
+		fmt.Printf("  Scan on %s failed, using cached results: %v\n", ifaceName, err)
+	}
+	cancel()
+
+	bsses, err := c.AccessPoints(ifi)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not get scan results: %v", err)
+	}
+
+	// Survey data is optional, not every driver reports it
+	surveys, err := c.SurveyInfo(ifi)
+	if err != nil {
+		surveys = nil
+	}
+
+	scores := scoreChannels(band, width, bsses, surveys)
+	if len(scores) == 0 {
+		return 0, nil, fmt.Errorf("no usable %s GHz channel for %d MHz", band, width)
+	}
+	return scores[0].Channel, scores, nil
+}
+
+// scoreChannels scores every candidate channel of band that fits width
+func scoreChannels(band string, width int, bsses []*wifi.BSS, surveys []*wifi.SurveyInfo) []ChannelScore {
+	candidates := acsCandidates24
+	switch band {
+	case "5":
+		candidates = acsCandidates5
+	case "6":
+		candidates = pscChannels6
+	}
+
+	survey := map[int]*wifi.SurveyInfo{}
+	for _, s := range surveys {
+		survey[s.Frequency] = s
+	}
+
+	var scores []ChannelScore
+	for _, ch := range candidates {
+		plan, err := PlanChannel(band, ch, width)
+		if err != nil {
+			continue
+		}
+		block := channelBlock(plan)
+
+		score := ChannelScore{
+			Channel:   ch,
+			Frequency: channelToFreq(band, ch),
+			Busy:      -1,
+		}
+
+		// Neighbours: a strong BSS counts more than a distant one
+		for _, bss := range bsses {
+			bssBand, bssCh := freqToChannel(bss.Frequency)
+			if bssBand != band || !overlaps(band, block, bssCh) {
+				continue
+			}
+			signal := int(bss.Signal / 100)
+			score.BSSCount++
+			if score.MaxSignal == 0 || signal > score.MaxSignal {
+				score.MaxSignal = signal
+			}
+			if w := signal + 100; w > 0 {
+				score.Score += float64(w)
+			}
+		}
+
+		// Survey: busy time and noise floor over the whole block
+		var busy, total time.Duration
+		for _, bch := range block {
+			s, ok := survey[channelToFreq(band, bch)]
+			if !ok {
+				continue
+			}
+			busy += s.ChannelTimeBusy
+			total += s.ChannelTime
+			if s.Noise != 0 && (score.Noise == 0 || s.Noise > score.Noise) {
+				score.Noise = s.Noise
+			}
+		}
+		if total > 0 {
+			score.Busy = float64(busy) / float64(total)
+			score.Score += score.Busy * 100
+		}
+		if score.Noise != 0 && score.Noise > -95 {
+			score.Score += float64(score.Noise + 95)
+		}
+
+		scores = append(scores, score)
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score < scores[j].Score
+	})
+	return scores
+}
+
+// channelBlock lists the 20 MHz channels covered by a channel plan
+func channelBlock(plan *ChannelPlan) []int {
+	switch {
+	case plan.Width == 20:
+		return []int{plan.Channel}
+	case plan.Band == "2.4" && plan.HT40 == "+":
+		return []int{plan.Channel, plan.Channel + 4}
+	case plan.Band == "2.4":
+		return []int{plan.Channel - 4, plan.Channel}
+	}
+
+	n := plan.Width / 20
+	// EHTCenterSeg0 covers the whole block, also for 320 MHz
+	first := plan.EHTCenterSeg0 - (n-1)*2
+	block := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		block = append(block, first+i*4)
+	}
+	return block
+}
+
+// overlaps reports whether a neighbour on channel ch interferes with block.
+// 2.4 GHz channels are 22 MHz wide and overlap up to 4 channels away.
+func overlaps(band string, block []int, ch int) bool {
+	for _, b := range block {
+		if band == "2.4" {
+			if d := b - ch; d > -5 && d < 5 {
+				return true
+			}
+			continue
+		}
+		if b == ch {
+			return true
+		}
+	}
+	return false
+}
@@ -2,11 +2,18 @@ package pkg
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/vishvananda/netlink"
 )
@@ -47,23 +54,60 @@ func UnblockRFKill(ifaceName string) error {
 	return nil
 }
 
-// WifiStandard represents the WiFi generation to use (up to Wi-Fi 6)
+// WifiStandard represents the WiFi generation to use (up to Wi-Fi 7)
 type WifiStandard string
 
 const (
 	Wifi4 WifiStandard = "wifi4" // 802.11n - 2.4GHz / 5GHz
 	Wifi5 WifiStandard = "wifi5" // 802.11ac - 5GHz
-	Wifi6 WifiStandard = "wifi6" // 802.11ax - 2.4GHz / 5GHz (NO 6GHz here)
+	Wifi6 WifiStandard = "wifi6" // 802.11ax - 2.4GHz / 5GHz / 6GHz
+	Wifi7 WifiStandard = "wifi7" // 802.11be - 2.4GHz / 5GHz / 6GHz, 320 MHz on 6GHz
 )
 
 // WifiConfig holds the WiFi configuration parameters
 type WifiConfig struct {
-	Standard WifiStandard // Wifi4, Wifi5, Wifi6
-	Band     string       // "2.4" or "5" (GHz) - optional, auto-selected if empty
+	Standard WifiStandard // Wifi4, Wifi5, Wifi6, Wifi7
+	Band     string       // "2.4", "5" or "6" (GHz) - optional, auto-selected if empty (6 must be explicit)
 	Channel  int          // optional, auto-selected if 0
+	Width    int          // 20, 40, 80, 160 or 320 (MHz) - optional, 20 on 2.4GHz, 80 on 5/6GHz (40 for Wifi4) if 0
+	Security SecurityMode // WPA2PSK, WPA3SAE, WPA2WPA3, SecurityOpen, OWE, OWETransition, WPA2Enterprise, WPA3Enterprise - optional, WPA2PSK if empty
+
+	Enterprise *EnterpriseConfig // required for WPA2Enterprise and WPA3Enterprise
+
+	Hidden  bool        // don't broadcast the SSID
+	Isolate bool        // stop clients from reaching each other (ap_isolate)
+	BSS     []BSSConfig // additional networks on the same radio, e.g. a guest network
+
+	Country string // ISO 3166-1 alpha2 country code - optional, US if empty
+	TxPower int    // transmit power in dBm - optional, driver default if 0
+
+	// Regulatory holds the kernel's rules for Country, used to reject
+	// channels, widths and power the country doesn't allow. StartHostapd
+	// queries it when nil, NewHostapdConfig then only checks the channel plan.
+	Regulatory *RegDomain
+
+	DFSFallbackChannel int // non-DFS 5GHz channel used after a radar hit - optional, auto-selected if 0
+
+	// DFS follows radar detection when the channel needs it. StartHostapd
+	// sets it, callers read its Status and Events to surface CAC progress.
+	DFS *DFSMonitor
+
+	// Downgrades lists the features StartHostapd replaced because hostapd
+	// or the driver doesn't support them
+	Downgrades DowngradeReport
+
+	// PHY holds the radio capabilities used to build ht_capab, vht_capab and
+	// the HE settings. StartHostapd queries it when nil, NewHostapdConfig falls
+	// back to flags every radio supports.
+	PHY *WiphyInfo
+
+	// Logger receives hostapd's output as structured records - optional,
+	// slog.Default() if nil. Records carry "source" and, when the line has
+	// them, "ifname", "mac", "ip" and "hostname"; the level is the severity.
+	Logger *slog.Logger
 }
 
-// normalizeBand maps common inputs to "2.4", "5", or "" (auto)
+// normalizeBand maps common inputs to "2.4", "5", "6" or "" (auto)
 func normalizeBand(b string) string {
 	b = strings.TrimSpace(strings.ToLower(b))
 	switch b {
@@ -73,20 +117,27 @@ func normalizeBand(b string) string {
 		return "2.4"
 	case "5", "5ghz", "5g":
 		return "5"
+	case "6", "6ghz", "6g", "6e":
+		return "6"
 	default:
 		// unknown -> treat as auto
 		return ""
 	}
 }
 
-// configureWifiSettings converts WifiConfig into hostapd parameters (up to Wi-Fi 6)
-func configureWifiSettings(config *WifiConfig) (hwMode string, channel int, ieee80211n, ieee80211ac, ieee80211ax bool) {
+// resolveBand returns the configured band or the default band of the standard
+func resolveBand(config *WifiConfig) string {
 	band := normalizeBand(config.Band)
 
+	// A 2.4 GHz channel implies the band
+	if band == "" && containsInt(channels24, config.Channel) {
+		band = "2.4"
+	}
+
 	// Default band by standard (sane defaults)
 	if band == "" {
 		switch config.Standard {
-		case Wifi5, Wifi6:
+		case Wifi5, Wifi6, Wifi7:
 			band = "5"
 		case Wifi4:
 			fallthrough
@@ -94,26 +145,46 @@ func configureWifiSettings(config *WifiConfig) (hwMode string, channel int, ieee
 			band = "2.4"
 		}
 	}
+	return band
+}
 
-	// hw_mode
-	if band == "2.4" {
-		hwMode = "g"
-	} else {
-		hwMode = "a"
+// legalChannel returns the best scored channel the regulatory rules allow, 0 if none
+func legalChannel(config *WifiConfig, band string, width int, scores []ChannelScore) int {
+	reg := config.Regulatory
+	for _, sc := range scores {
+		if reg == nil {
+			return sc.Channel
+		}
+		plan, err := PlanChannel(band, sc.Channel, width)
+		if err != nil {
+			continue
+		}
+		if _, err := reg.CheckChannel(plan, config.Standard, config.TxPower); err == nil {
+			return sc.Channel
+		}
 	}
+	return 0
+}
 
-	// default channel
-	channel = config.Channel
-	if channel == 0 {
-		if band == "2.4" {
-			channel = 6
-		} else {
-			channel = 36
-		}
+// countryCode returns the configured country code, US if empty
+func countryCode(config *WifiConfig) string {
+	if config.Country == "" {
+		return "US"
+	}
+	return strings.ToUpper(config.Country)
+}
+
+// bandCapabilities returns the radio capabilities for the configured band, or nil
+func bandCapabilities(config *WifiConfig) *BandCapabilities {
+	if config.PHY == nil {
+		return nil
 	}
+	return config.PHY.Band(resolveBand(config))
+}
 
-	// enable standards
-	switch config.Standard {
+// enabledStandards returns which of 802.11n/ac/ax/be a standard enables on band
+func enabledStandards(standard WifiStandard, band string) (ieee80211n, ieee80211ac, ieee80211ax, ieee80211be bool) {
+	switch standard {
 	case Wifi4:
 		ieee80211n = true
 	case Wifi5:
@@ -123,6 +194,11 @@ func configureWifiSettings(config *WifiConfig) (hwMode string, channel int, ieee
 		ieee80211n = true
 		ieee80211ac = true
 		ieee80211ax = true
+	case Wifi7:
+		ieee80211n = true
+		ieee80211ac = true
+		ieee80211ax = true
+		ieee80211be = true
 	default:
 		// default to Wi-Fi 6
 		ieee80211n = true
@@ -134,31 +210,204 @@ func configureWifiSettings(config *WifiConfig) (hwMode string, channel int, ieee
 	if band != "5" {
 		ieee80211ac = false
 	}
+	// 6GHz has no HT/VHT operation, only HE and EHT
+	if band == "6" {
+		ieee80211n = false
+	}
+	return
+}
+
+// configureWifiSettings converts WifiConfig into hostapd radio parameters (up to Wi-Fi 7)
+func configureWifiSettings(conf *HostapdConfig, config *WifiConfig) error {
+	band := resolveBand(config)
+
+	// hw_mode
+	hwMode := "a"
+	if band == "2.4" {
+		hwMode = "g"
+	}
+
+	// default channel
+	channel := config.Channel
+	if channel == 0 {
+		switch band {
+		case "2.4":
+			channel = 6
+		case "6":
+			// PSC channel, found by clients without a 2.4/5 GHz neighbor report
+			channel = 37
+		default:
+			channel = 36
+		}
+	}
+
+	ieee80211n, ieee80211ac, ieee80211ax, ieee80211be := enabledStandards(config.Standard, band)
+
+	width := config.Width
+	if width == 0 {
+		width = defaultWidth(band, config.Standard)
+	}
+	if width > 40 && !ieee80211ac && !ieee80211ax {
+		return fmt.Errorf("%d MHz channels need wifi5 or newer", width)
+	}
+	if width == 320 && !ieee80211be {
+		return fmt.Errorf("320 MHz channels need wifi7")
+	}
 
-	return hwMode, channel, ieee80211n, ieee80211ac, ieee80211ax
+	plan, err := PlanChannel(band, channel, width)
+	if err != nil {
+		return err
+	}
+
+	var caps *BandCapabilities
+	if config.PHY != nil {
+		if caps = config.PHY.Band(band); caps == nil {
+			return fmt.Errorf("radio doesn't support the %s GHz band", band)
+		}
+	}
+
+	s := conf.Main()
+	s.Set("hw_mode", hwMode)
+	s.Set("channel", strconv.Itoa(channel))
+	if plan.OpClass != 0 {
+		s.Set("op_class", strconv.Itoa(plan.OpClass))
+	}
+	s.Set("country_code", countryCode(config))
+	s.Set("ieee80211d", "1")
+	// Radar detection (DFS) is only needed when the channel block requires it
+	if isDFSPlan(config.Regulatory, plan, config.Standard) {
+		s.Set("ieee80211h", "1")
+	}
+
+	if ieee80211n {
+		htCapab, err := htCapab(caps, plan)
+		if err != nil {
+			return err
+		}
+		s.Set("ieee80211n", "1")
+		s.Set("ht_capab", htCapab)
+	}
+	if ieee80211ac {
+		vhtCapab, err := vhtCapab(caps, plan)
+		if err != nil {
+			return err
+		}
+		s.Set("ieee80211ac", "1")
+		s.Set("vht_oper_chwidth", strconv.Itoa(plan.ChWidth))
+		if plan.CenterSeg0 != 0 {
+			s.Set("vht_oper_centr_freq_seg0_idx", strconv.Itoa(plan.CenterSeg0))
+		}
+		if vhtCapab != "" {
+			s.Set("vht_capab", vhtCapab)
+		}
+	}
+	// WiFi 6 (802.11ax) support - only if hostapd supports it
+	// Note: Some hostapd builds don't include 802.11ax support
+	// If you get errors, your hostapd may not be compiled with CONFIG_IEEE80211AX=y
+	if ieee80211ax {
+		if err := checkHEWidth(caps, plan); err != nil {
+			return err
+		}
+		suBeamformer, suBeamformee, muBeamformer := heBeamforming(caps)
+		s.Set("ieee80211ax", "1")
+		s.Set("he_su_beamformer", boolToFlag(suBeamformer))
+		s.Set("he_su_beamformee", boolToFlag(suBeamformee))
+		s.Set("he_mu_beamformer", boolToFlag(muBeamformer))
+		s.Set("he_bss_color", "1")
+		s.Set("he_default_pe_duration", "4")
+		s.Set("he_rts_threshold", "1023")
+		s.Set("he_mu_edca_qos_info_param_count", "0")
+		s.Set("he_mu_edca_qos_info_q_ack", "0")
+		s.Set("he_mu_edca_qos_info_queue_request", "0")
+		s.Set("he_mu_edca_qos_info_txop_request", "0")
+		if band != "2.4" {
+			s.Set("he_oper_chwidth", strconv.Itoa(plan.ChWidth))
+			if plan.CenterSeg0 != 0 {
+				s.Set("he_oper_centr_freq_seg0_idx", strconv.Itoa(plan.CenterSeg0))
+			}
+		}
+	}
+	// WiFi 7 (802.11be) needs hostapd compiled with CONFIG_IEEE80211BE=y
+	if ieee80211be {
+		if err := checkEHTWidth(caps, plan); err != nil {
+			return err
+		}
+		s.Set("ieee80211be", "1")
+		if band != "2.4" {
+			s.Set("eht_oper_chwidth", strconv.Itoa(plan.EHTChWidth))
+			if plan.EHTCenterSeg0 != 0 {
+				s.Set("eht_oper_centr_freq_seg0_idx", strconv.Itoa(plan.EHTCenterSeg0))
+			}
+		}
+	}
+	return nil
 }
 
-// checkHostapdWifi6Support checks if hostapd supports 802.11ax
-func checkHostapdWifi6Support() bool {
-	// Create a minimal test config with ax support
-	testConf := `interface=test
-ieee80211ax=1`
-	tmpFile := "/tmp/hostapd_ax_test.conf"
-	if err := os.WriteFile(tmpFile, []byte(testConf), 0644); err != nil {
-		return false
-	}
-	defer os.Remove(tmpFile)
-
-	// Try to parse the config
-	cmd := exec.Command("hostapd", "-t", tmpFile)
-	err := cmd.Run()
-	// If hostapd exits without "unknown configuration" error, ax is supported
-	return err == nil
+// NewHostapdConfig builds the hostapd configuration for ifaceName without
+// touching the system, so the result can be inspected or compared before
+// StartHostapd writes it.
+func NewHostapdConfig(ifaceName, ssid, password string, config *WifiConfig) (*HostapdConfig, error) {
+	if config == nil {
+		config = &WifiConfig{
+			Standard: Wifi6,
+			Band:     "5",
+		}
+	}
+
+	if err := ValidateWifiConfig(ssid, password, config); err != nil {
+		return nil, err
+	}
+
+	conf := &HostapdConfig{}
+	s := conf.Main()
+	s.Set("interface", ifaceName)
+	s.Set("driver", "nl80211")
+	// Control sockets for DialHostapd, only root can reach the runtime directory
+	s.Set("ctrl_interface", HostapdCtrlDir(ifaceName))
+	s.Set("ctrl_interface_group", "0")
+	setSSID(s, ssid)
+	setBSSOptions(s, config.Hidden, config.Isolate)
+
+	if err := configureWifiSettings(conf, config); err != nil {
+		return nil, err
+	}
+
+	band := resolveBand(config)
+	configureSecurity(conf, s, ssid, password, config.Security, config.Enterprise, band)
+
+	for i := range config.BSS {
+		configureBSS(conf, ifaceName, i, &config.BSS[i], band)
+	}
+	if err := checkInterfaceCombinations(conf, config.PHY); err != nil {
+		return nil, err
+	}
+	configureACL(conf, ifaceName)
+
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
 }
 
-// StartHostapd configures and starts hostapd.
+// Files of hostapd in the runtime directory
+const (
+	hostapdConfFile = "hostapd.conf"
+	hostapdPIDFile  = "hostapd.pid"
+)
+
+// hostapdFiles are removed when hostapd stops
+var hostapdFiles = []string{hostapdConfFile, hostapdPIDFile, hostapdCtrlDir, eapUserFile, eapCACertFile, eapCertFile, eapKeyFile}
+
+// StartHostapd configures and starts hostapd, it returns once the AP is
+// enabled or fails with hostapd's output after HostapdStartTimeout.
 // addrAndMask example: "192.168.107.1/24"
 func StartHostapd(ctx context.Context, ifaceName, addrAndMask, ssid, password string, config *WifiConfig) (*exec.Cmd, error) {
+	return startHostapd(ctx, ifaceName, addrAndMask, ssid, password, config, io.Discard, nil)
+}
+
+// startHostapd is StartHostapd with hostapd's raw output also sent to out
+// and logged to logger when config has no Logger
+func startHostapd(ctx context.Context, ifaceName, addrAndMask, ssid, password string, config *WifiConfig, out io.Writer, logger *slog.Logger) (*exec.Cmd, error) {
 	// Default config if none provided: Wi-Fi 6 on 5GHz
 	if config == nil {
 		config = &WifiConfig{
@@ -167,15 +416,65 @@ func StartHostapd(ctx context.Context, ifaceName, addrAndMask, ssid, password st
 		}
 	}
 
-	// Check if WiFi 6 is requested but not supported
-	if config.Standard == Wifi6 && !checkHostapdWifi6Support() {
-		fmt.Println("WARNING: WiFi 6 (802.11ax) requested but your hostapd doesn't support it.")
-		fmt.Println("         Falling back to WiFi 5 (802.11ac). To fix this, install a newer hostapd")
-		fmt.Println("         compiled with CONFIG_IEEE80211AX=y support.")
-		config.Standard = Wifi5
+	// Validate credentials and radio settings before touching the interface
+	if err := ValidateWifiConfig(ssid, password, config); err != nil {
+		return nil, err
+	}
+
+	// Refuse to clobber the files of another instance on the same interface
+	dir := newRuntimeDir(ifaceName)
+	if err := dir.create(); err != nil {
+		return nil, err
+	}
+	if err := dir.checkPID(hostapdPIDFile); err != nil {
+		return nil, err
+	}
+
+	// Read the radio capabilities to build ht/vht/he flags the hardware supports
+	if config.PHY == nil {
+		phy, err := GetWiphyInfo(ifaceName)
+		if err != nil {
+			fmt.Printf("Note: could not read radio capabilities, using safe defaults and assuming PMF and SAE work: %v\n", err)
+		} else {
+			config.PHY = phy
+		}
 	}
 
-	hwMode, channel, ieee80211n, ieee80211ac, ieee80211ax := configureWifiSettings(config)
+	// Apply the country and read its rules to reject illegal channels before hostapd does
+	if config.Regulatory == nil {
+		reg, err := SetRegDomain(ifaceName, countryCode(config))
+		if err != nil {
+			fmt.Printf("Note: could not read regulatory rules, channels are not checked: %v\n", err)
+		} else {
+			if reg.Country != countryCode(config) {
+				fmt.Printf("WARNING: regulatory domain of %s is %s, not %s. The driver or a stricter\n", ifaceName, reg.Country, countryCode(config))
+				fmt.Println("         domain (e.g. from the radio EEPROM) takes precedence, its rules are used.")
+			}
+			config.Regulatory = reg
+		}
+	}
+
+	// Give up features hostapd or the driver can't do, reported all at once
+	hostapdCaps, err := ProbeHostapd()
+	if err != nil {
+		return nil, err
+	}
+	report, err := applyRequirements(ifaceName, hostapdCaps, config)
+	config.Downgrades = report
+	warnDowngrades(hostapdCaps, ifaceName, report)
+	if err != nil {
+		return nil, err
+	}
+	if err := check6GHz(ifaceName, config); err != nil {
+		return nil, err
+	}
+
+	// Channel legality depends on the final standard (no-HE / no-EHT rules)
+	if config.Regulatory != nil && config.Channel != 0 {
+		if err := ValidateWifiConfig(ssid, password, config); err != nil {
+			return nil, err
+		}
+	}
 
 	// Unblock rfkill - this is usually not critical
 	UnblockRFKill(ifaceName)
@@ -194,116 +493,307 @@ func StartHostapd(ctx context.Context, ifaceName, addrAndMask, ssid, password st
 		return nil, fmt.Errorf("error bringing up the interface: %v", err)
 	}
 
-	confContent := fmt.Sprintf(`interface=%s
-driver=nl80211
-ssid=%s
-hw_mode=%s
-channel=%d
-wpa=2
-wpa_passphrase=%s
-wpa_key_mgmt=WPA-PSK
-rsn_pairwise=CCMP
-country_code=US
-ieee80211d=1
-ieee80211h=1`, ifaceName, ssid, hwMode, channel, password)
+	// Pick the least congested channel when none was requested
+	if config.Channel == 0 {
+		band := resolveBand(config)
+		width := config.Width
+		if width == 0 {
+			width = defaultWidth(band, config.Standard)
+		}
+		_, scores, err := SelectChannel(ctx, ifaceName, band, width)
+		if err != nil {
+			fmt.Printf("Note: automatic channel selection failed, using default channel: %v\n", err)
+		} else if channel := legalChannel(config, band, width, scores); channel != 0 {
+			fmt.Printf("Selected channel %d:\n", channel)
+			for _, sc := range scores {
+				fmt.Printf("  %s\n", sc)
+			}
+			config.Channel = channel
+		} else {
+			fmt.Printf("Note: no scanned channel is allowed in %s, using default channel\n", countryCode(config))
+		}
+	}
+
+	if config.TxPower != 0 {
+		if err := SetTxPower(ifaceName, config.TxPower); err != nil {
+			fmt.Printf("WARNING: %v, using the driver default\n", err)
+		}
+	}
 
-	if ieee80211n {
-		confContent += "\nieee80211n=1"
-		confContent += "\nht_capab=[HT40+][SHORT-GI-20][SHORT-GI-40][DSSS_CCK-40]"
+	// Every additional BSS needs its own BSSID
+	for i := range config.BSS {
+		if config.BSS[i].MAC != nil {
+			continue
+		}
+		ifi, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			return nil, fmt.Errorf("interface not found %s: %v", ifaceName, err)
+		}
+		config.BSS[i].MAC = deriveBSSMAC(ifi.HardwareAddr, i)
 	}
-	if ieee80211ac {
-		confContent += "\nieee80211ac=1"
-		confContent += "\nvht_oper_chwidth=1"
-		confContent += "\nvht_oper_centr_freq_seg0_idx=42"
-		confContent += "\nvht_capab=[MAX-MPDU-11454][RXLDPC][SHORT-GI-80][TX-STBC-2BY1][RX-STBC-1]"
+
+	conf, err := NewHostapdConfig(ifaceName, ssid, password, config)
+	if err != nil {
+		return nil, err
 	}
-	// WiFi 6 (802.11ax) support - only if hostapd supports it
-	// Note: Some hostapd builds don't include 802.11ax support
-	// If you get errors, your hostapd may not be compiled with CONFIG_IEEE80211AX=y
-	if ieee80211ax {
-		// Test if hostapd supports 802.11ax by checking version
-		// For now, we'll try to add the config and let hostapd fail gracefully
-		// You can disable this by using Wifi5 instead of Wifi6
-		confContent += "\nieee80211ax=1"
-		confContent += "\nhe_su_beamformer=1"
-		confContent += "\nhe_su_beamformee=1"
-		confContent += "\nhe_mu_beamformer=1"
-		confContent += "\nhe_bss_color=1"
-		confContent += "\nhe_default_pe_duration=4"
-		confContent += "\nhe_rts_threshold=1023"
-		confContent += "\nhe_mu_edca_qos_info_param_count=0"
-		confContent += "\nhe_mu_edca_qos_info_q_ack=0"
-		confContent += "\nhe_mu_edca_qos_info_queue_request=0"
-		confContent += "\nhe_mu_edca_qos_info_txop_request=0"
-	}
-
-	configFile := "hostapd_temp.conf"
-	if err := os.WriteFile(configFile, []byte(confContent), 0644); err != nil {
-		return nil, fmt.Errorf("could not create hostapd config file: %v", err)
-	}
-
-	cmd := exec.CommandContext(ctx, "hostapd", configFile)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+
+	// Banned clients stay banned across restarts
+	if err := ensureDenyList(ifaceName); err != nil {
+		return nil, err
+	}
+
+	// The config holds the passphrase, only root may read it
+	if err := dir.writeFile(hostapdConfFile, []byte(conf.Render())); err != nil {
+		return nil, err
+	}
+
+	if config.Security.isEnterprise() && config.Enterprise.usesEAPServer() {
+		if err := writeEAPServerFiles(dir, config.Enterprise); err != nil {
+			dir.remove(hostapdFiles...)
+			return nil, err
+		}
+	}
+
+	// hostapd reports AP-ENABLED once it beacons, the output is kept for startup errors
+	enabled := make(chan struct{})
+	var enabledOnce sync.Once
+	startup := &tailWriter{max: startupOutputLines, onLine: func(line string) {
+		if strings.Contains(line, "AP-ENABLED") {
+			enabledOnce.Do(func() { close(enabled) })
+		}
+	}}
+	logger = processLogger(config.Logger, logger)
+	output := io.MultiWriter(newProcessLog("hostapd", parseHostapdLine, logger), startup, out)
+
+	cmd := exec.CommandContext(ctx, "hostapd", dir.file(hostapdConfFile))
+	cmd.Stdout = output
+	cmd.Stderr = output
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
+	// Remember what hostapd runs with for ReconfigureHostapd
+	inst := &hostapdInstance{
+		ifaceName:   ifaceName,
+		addrAndMask: addrAndMask,
+		ssid:        ssid,
+		password:    password,
+		config:      config,
+		conf:        conf,
+		dir:         dir,
+		out:         out,
+		logger:      logger,
+	}
+
+	// DFS channels start with a channel availability check and may have to move on radar
+	config.DFS = nil
+	var cacTime time.Duration
+	if plan, err := configPlan(config); err == nil && isDFSPlan(config.Regulatory, plan, config.Standard) {
+		cacTime = expectedCACTime(config.Regulatory, plan)
+		fallback, fallbackWidth := dfsFallbackChannel(config, plan.Width)
+		fmt.Printf("Note: channel %d needs radar detection (DFS), the AP starts after a %s channel availability check\n", plan.Channel, cacTime)
+		if fallback == 0 {
+			fmt.Println("WARNING: no non-DFS fallback channel is allowed, the AP stops if radar is detected")
+		}
+
+		var move func(channel int) error
+		if fallback != 0 {
+			move = func(channel int) error {
+				inst.mu.Lock()
+				defer inst.mu.Unlock()
+				// A restart by ReconfigureHostapd replaced the process
+				if _, err := lookupInstance(cmd); err != nil {
+					return err
+				}
+				moved := *inst.config
+				moved.Channel = channel
+				moved.Width = fallbackWidth
+				return inst.reload(cmd, inst.ssid, inst.password, &moved)
+			}
+		}
+		config.DFS = newDFSMonitor(plan.Channel, fallback, cacTime, move)
+	}
+
 	if err := cmd.Start(); err != nil {
+		dir.remove(hostapdFiles...)
+		return nil, err
+	}
+	if err := dir.writePID(hostapdPIDFile, cmd); err != nil {
+		fmt.Printf("Note: %v\n", err)
+	}
+	// The DFS monitor follows the control interface until hostapd stops
+	dfsCtx, stopDFS := context.WithCancel(ctx)
+	if config.DFS != nil {
+		go config.DFS.follow(dfsCtx, ifaceName)
+	}
+	hostapdInstances.Store(cmd, inst)
+	onStop(cmd, func() {
+		stopDFS()
+		hostapdInstances.Delete(cmd)
+		dir.remove(hostapdFiles...)
+	})
+
+	// Return once the AP beacons, a DFS channel first needs its availability check
+	isEnabled := func() bool { return hostapdEnabled(ifaceName) }
+	if err := waitReady(ctx, cmd, "hostapd", HostapdStartTimeout+cacTime, enabled, isEnabled, startup); err != nil {
 		return nil, err
 	}
 	return cmd, nil
 }
 
-// StartDnsmasq runs dnsmasq in foreground (--no-daemon) with a /24 DHCP range,
-// bound to the given interface and listen IP.
+// check6GHz rejects a 6GHz config that lost WiFi 6 or WPA3/OWE to a
+// downgrade, 6GHz can't fall back to another standard or security mode
+func check6GHz(ifaceName string, config *WifiConfig) error {
+	if resolveBand(config) != "6" {
+		return nil
+	}
+	if config.Standard == Wifi4 || config.Standard == Wifi5 {
+		return fmt.Errorf("the 6 GHz band requires WiFi 6 support in hostapd and the driver")
+	}
+	if config.PHY != nil && bandCapabilities(config) == nil {
+		return fmt.Errorf("radio of %s doesn't support the 6 GHz band", ifaceName)
+	}
+	if !config.Security.allowedOn6GHz() {
+		return fmt.Errorf("%s is not supported by hostapd or the driver, but 6 GHz requires WPA3 or OWE", config.Security)
+	}
+	for _, b := range config.BSS {
+		if !b.Security.allowedOn6GHz() {
+			return fmt.Errorf("%s of %s is not supported by hostapd or the driver, but 6 GHz requires WPA3 or OWE", b.Security, b.SSID)
+		}
+	}
+	return nil
+}
+
+// configPlan returns the channel plan of a config with a channel set
+func configPlan(config *WifiConfig) (*ChannelPlan, error) {
+	band := resolveBand(config)
+	width := config.Width
+	if width == 0 {
+		width = defaultWidth(band, config.Standard)
+	}
+	return PlanChannel(band, config.Channel, width)
+}
+
+// dhcpServerPort is the UDP port dnsmasq binds for DHCP
+const dhcpServerPort = 67
+
+// Files of dnsmasq in the runtime directory
+const (
+	dnsmasqPIDFile   = "dnsmasq.pid"
+	dnsmasqLeaseFile = "dnsmasq.leases"
+)
+
+// StartDnsmasq runs dnsmasq in foreground (--no-daemon) as DHCP and DNS
+// server of the AP, bound to the given interface and the gateway address of
+// dhcp. It returns once dnsmasq listens for DHCP requests or fails after
+// DnsmasqStartTimeout.
 //
 // Needs root privileges. The simplest is to run your Go program with sudo.
-func StartDnsmasq(ctx context.Context, iface string, listenIP string) (*exec.Cmd, error) {
-	if iface == "" || listenIP == "" {
-		return nil, fmt.Errorf("iface and listenIP are required")
+func StartDnsmasq(ctx context.Context, iface string, dhcp *DHCPConfig) (*exec.Cmd, error) {
+	return startDnsmasq(ctx, iface, dhcp, io.Discard, nil)
+}
+
+// startDnsmasq is StartDnsmasq with dnsmasq's raw output also sent to out
+// and logged to logger when dhcp has no Logger
+func startDnsmasq(ctx context.Context, iface string, dhcp *DHCPConfig, out io.Writer, logger *slog.Logger) (*exec.Cmd, error) {
+	if iface == "" || dhcp == nil {
+		return nil, fmt.Errorf("iface and dhcp are required")
+	}
+	reservationsMu.Lock()
+	err := dhcp.Validate()
+	reservations := append([]DHCPReservation(nil), dhcp.Reservations...)
+	reservationsMu.Unlock()
+	if err != nil {
+		return nil, err
 	}
 
-	// Build DHCP range based on the listen IP, assuming /24:
-	// e.g. 192.168.107.1 -> 192.168.107.10 - 192.168.107.200
-	var a, b, c, d int
-	if _, err := fmt.Sscanf(listenIP, "%d.%d.%d.%d", &a, &b, &c, &d); err != nil ||
-		a < 0 || a > 255 || b < 0 || b > 255 || c < 0 || c > 255 || d < 0 || d > 255 {
-		return nil, fmt.Errorf("invalid listen IP: %q", listenIP)
+	// Keep the PID and lease files per instance instead of the system-wide defaults
+	dir := newRuntimeDir(iface)
+	if err := dir.create(); err != nil {
+		return nil, err
+	}
+	if err := dir.checkPID(dnsmasqPIDFile); err != nil {
+		return nil, err
+	}
+	// Reservations live in a hosts file so they can change without a restart
+	if err := writeHostsFile(dir, reservations); err != nil {
+		return nil, err
 	}
-	rangeStart := fmt.Sprintf("%d.%d.%d.%d", a, b, c, 10)
-	rangeEnd := fmt.Sprintf("%d.%d.%d.%d", a, b, c, 200)
 
 	args := []string{
 		"--no-daemon",
 		"--conf-file=/dev/null",
 		"--interface=" + iface,
 		"--bind-interfaces",
-		"--listen-address=" + listenIP,
-		"--dhcp-range=" + rangeStart + "," + rangeEnd + ",255.255.255.0,12h",
-		"--dhcp-option=option:router," + listenIP,
-		"--dhcp-option=option:dns-server," + listenIP,
+		"--dhcp-leasefile=" + dir.file(dnsmasqLeaseFile),
+		"--dhcp-hostsfile=" + dir.file(dnsmasqHostsFile),
 		// If you want DHCP only (no DNS), uncomment:
 		// "--port=0",
 	}
+	args = append(args, dhcp.dnsmasqArgs()...)
+
+	// Keep the output for startup errors
+	startup := &tailWriter{max: startupOutputLines}
+	output := io.MultiWriter(newProcessLog("dnsmasq", parseDnsmasqLine, processLogger(dhcp.Logger, logger)), startup, out)
 
 	cmd := exec.CommandContext(ctx, "dnsmasq", args...)
-	// Send dnsmasq logs to your program output
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// Send dnsmasq logs to the logger as structured records
+	cmd.Stdout = output
+	cmd.Stderr = output
 
 	// Put dnsmasq in its own process group so we can stop the whole group cleanly.
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	if err := cmd.Start(); err != nil {
+		dir.remove(dnsmasqHostsFile)
+		return nil, err
+	}
+	// --no-daemon doesn't write a PID file, record it for the next instance
+	if err := dir.writePID(dnsmasqPIDFile, cmd); err != nil {
+		fmt.Printf("Note: %v\n", err)
+	}
+	dhcpConfigs.Store(iface, dhcp)
+	onStop(cmd, func() {
+		dhcpConfigs.CompareAndDelete(iface, dhcp)
+		// The lease file stays, a restarted dnsmasq must not hand out
+		// addresses that clients still hold
+		dir.remove(dnsmasqPIDFile, dnsmasqHostsFile)
+	})
+
+	// Return once dnsmasq listens for DHCP requests
+	dhcpBound := func() bool {
+		bound, _ := udpPortBound(cmd.Process.Pid, dhcpServerPort)
+		return bound
+	}
+	if err := waitReady(ctx, cmd, "dnsmasq", DnsmasqStartTimeout, nil, dhcpBound, startup); err != nil {
 		return nil, err
 	}
 	return cmd, nil
 }
 
+// StopCmd terminates the process group of cmd, waits for it and removes
+// its runtime files
 func StopCmd(cmd *exec.Cmd) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	terminateCmd(cmd)
+	// cmd.Wait also closes the output pipes and ends the goroutines copying
+	// them, the exit status of a terminated process is expected
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			fmt.Printf("WARNING: could not wait for %s: %v\n", cmd.Path, err)
+		}
+	}
+
+	// Remove the runtime files of the process, like configs holding secrets
+	runCleanup(cmd)
+}
+
+// terminateCmd asks cmd to exit without waiting for it
+func terminateCmd(cmd *exec.Cmd) {
 	if cmd == nil || cmd.Process == nil {
 		return
 	}
 	// Kill the process group (negative PID) for a clean shutdown.
 	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
-	_, _ = cmd.Process.Wait()
 }
@@ -0,0 +1,25 @@
+package pkg
+
+import (
+	"bytes"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestStopCmdReleasesOutputPipes(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	// Not an *os.File, so exec copies the output through a pipe
+	cmd.Stdout = &bytes.Buffer{}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't start sleep: %v", err)
+	}
+
+	StopCmd(cmd)
+	// Only cmd.Wait sets ProcessState, after closing the pipe and ending
+	// the goroutine copying it
+	if cmd.ProcessState == nil {
+		t.Fatal("StopCmd didn't reap the process with cmd.Wait")
+	}
+}
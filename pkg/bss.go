@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// BSSConfig describes an additional network (SSID) served by the same radio
+type BSSConfig struct {
+	SSID       string
+	Password   string            // must be empty for open modes and enterprise
+	Security   SecurityMode      // optional, WPA2PSK if empty
+	Enterprise *EnterpriseConfig // RADIUS only, the integrated EAP server serves the main network
+
+	Hidden  bool // don't broadcast the SSID
+	Isolate bool // stop clients from reaching each other (ap_isolate)
+
+	// Ifname is the virtual interface hostapd creates - optional, <iface>_<n> if empty
+	Ifname string
+	// MAC is the BSSID - optional, StartHostapd derives a locally administered
+	// address from the radio's MAC when nil
+	MAC net.HardwareAddr
+}
+
+// bssIfname returns the virtual interface name of the i-th additional BSS
+func bssIfname(ifaceName string, i int, b *BSSConfig) string {
+	if b.Ifname != "" {
+		return b.Ifname
+	}
+	return deriveBSSIfname(ifaceName, strconv.Itoa(i+1))
+}
+
+// deriveBSSMAC derives the BSSID of the i-th additional BSS from the radio's
+// MAC: locally administered, and only the last byte differs so drivers with
+// a BSSID mask accept it
+func deriveBSSMAC(base net.HardwareAddr, i int) net.HardwareAddr {
+	if len(base) != 6 {
+		return nil
+	}
+	mac := append(net.HardwareAddr(nil), base...)
+	mac[0] |= 0x02
+	mac[5] += byte(i + 1)
+	return mac
+}
+
+// setBSSOptions writes the hidden and isolation settings of a BSS
+func setBSSOptions(s *HostapdSection, hidden, isolate bool) {
+	if hidden {
+		s.Set("ignore_broadcast_ssid", "1")
+	}
+	if isolate {
+		s.Set("ap_isolate", "1")
+	}
+}
+
+// configureBSS adds the bss= section of the i-th additional network
+func configureBSS(conf *HostapdConfig, ifaceName string, i int, b *BSSConfig, band string) {
+	s := conf.AddBSS(bssIfname(ifaceName, i, b))
+	if b.MAC != nil {
+		s.Set("bssid", b.MAC.String())
+	}
+	setSSID(s, b.SSID)
+	setBSSOptions(s, b.Hidden, b.Isolate)
+	configureSecurity(conf, s, b.SSID, b.Password, b.Security, b.Enterprise, band)
+}
+
+// validateBSSList checks the additional networks of config
+func validateBSSList(verr *ValidationError, config *WifiConfig) {
+	ifnames := map[string]bool{}
+	for i := range config.BSS {
+		b := &config.BSS[i]
+		sub := &ValidationError{}
+
+		validateSSID(sub, "ssid", b.SSID)
+		validateSecurity(sub, b.Password, b.Security, b.Enterprise)
+		if resolveBand(config) == "6" {
+			validate6GHzSecurity(sub, b.Security)
+		}
+		if b.Security.isEnterprise() && b.Enterprise != nil && b.Enterprise.usesEAPServer() {
+			sub.add("enterprise", "the integrated EAP server only serves the main network, use auth_servers")
+		}
+
+		if b.Ifname != "" {
+			if len(b.Ifname) >= unix.IFNAMSIZ {
+				sub.add("ifname", "must be at most %d characters", unix.IFNAMSIZ-1)
+			}
+			if ifnames[b.Ifname] {
+				sub.add("ifname", "%s is used by another BSS", b.Ifname)
+			}
+			ifnames[b.Ifname] = true
+		}
+		if b.MAC != nil && (len(b.MAC) != 6 || b.MAC[0]&0x01 != 0) {
+			sub.add("mac", "%s is not a unicast MAC address", b.MAC)
+		}
+
+		verr.merge(fmt.Sprintf("bss[%d].", i), sub)
+	}
+}
+
+// checkInterfaceCombinations rejects configs with more BSSes than the radio
+// can run at the same time
+func checkInterfaceCombinations(conf *HostapdConfig, phy *WiphyInfo) error {
+	if phy == nil || len(conf.Sections) <= 1 {
+		return nil
+	}
+	if len(conf.Sections) > phy.MaxAPInterfaces {
+		return fmt.Errorf("radio %s supports %d AP interfaces, the configuration needs %d", phy.Name, phy.MaxAPInterfaces, len(conf.Sections))
+	}
+	return nil
+}
+
+// parseCombinations computes the number of AP interfaces the radio can run
+// at the same time from NL80211_ATTR_INTERFACE_COMBINATIONS. Without any
+// combination the radio only supports a single interface.
+func (w *WiphyInfo) parseCombinations(ad *netlink.AttributeDecoder) error {
+	for ad.Next() {
+		ad.Nested(func(cad *netlink.AttributeDecoder) error {
+			var maxNum, aps int
+			for cad.Next() {
+				switch cad.Type() {
+				case unix.NL80211_IFACE_COMB_MAXNUM:
+					maxNum = int(cad.Uint32())
+				case unix.NL80211_IFACE_COMB_LIMITS:
+					cad.Nested(func(lad *netlink.AttributeDecoder) error {
+						for lad.Next() {
+							lad.Nested(func(l *netlink.AttributeDecoder) error {
+								limit, ap := parseIfaceLimit(l)
+								if ap {
+									aps += limit
+								}
+								return l.Err()
+							})
+						}
+						return lad.Err()
+					})
+				}
+			}
+			if aps > maxNum {
+				aps = maxNum
+			}
+			if aps > w.MaxAPInterfaces {
+				w.MaxAPInterfaces = aps
+			}
+			return cad.Err()
+		})
+	}
+	return ad.Err()
+}
+
+// parseIfaceLimit decodes one interface limit and reports whether it allows APs
+func parseIfaceLimit(ad *netlink.AttributeDecoder) (limit int, ap bool) {
+	for ad.Next() {
+		switch ad.Type() {
+		case unix.NL80211_IFACE_LIMIT_MAX:
+			limit = int(ad.Uint32())
+		case unix.NL80211_IFACE_LIMIT_TYPES:
+			ad.Nested(func(tad *netlink.AttributeDecoder) error {
+				for tad.Next() {
+					if tad.Type() == unix.NL80211_IFTYPE_AP {
+						ap = true
+					}
+				}
+				return tad.Err()
+			})
+		}
+	}
+	return limit, ap
+}
@@ -0,0 +1,195 @@
+package pkg
+
+import (
+	"fmt"
+)
+
+// ChannelPlan is the channel layout hostapd needs for a primary channel and width
+type ChannelPlan struct {
+	Band    string // "2.4", "5" or "6"
+	Channel int    // primary 20 MHz channel
+	Width   int    // 20, 40, 80, 160 or 320 MHz
+	HT40    string // "+" or "-" for 40 MHz and wider, "" for 20 MHz
+
+	// CenterSeg0 is vht/he_oper_centr_freq_seg0_idx, 0 when not needed
+	CenterSeg0 int
+	// ChWidth is vht/he_oper_chwidth: 0 = 20/40 MHz, 1 = 80 MHz, 2 = 160 MHz
+	ChWidth int
+
+	// EHTCenterSeg0 and EHTChWidth are the eht_oper_* values. They only differ
+	// from the HE values for 320 MHz, where HE uses the primary 160 MHz half.
+	EHTCenterSeg0 int
+	EHTChWidth    int // 0 = 20/40 MHz, 1 = 80 MHz, 2 = 160 MHz, 9 = 320 MHz
+
+	// OpClass is the global operating class, required by hostapd on 6 GHz
+	OpClass int
+}
+
+// blockStarts5 lists the first 20 MHz channel of each valid 5 GHz block per width
+var blockStarts5 = map[int][]int{
+	40:  {36, 44, 52, 60, 100, 108, 116, 124, 132, 140, 149, 157, 165, 173},
+	80:  {36, 52, 100, 116, 132, 149, 165},
+	160: {36, 100, 149},
+}
+
+// blockStarts6 lists the first 20 MHz channel of each 6 GHz block per width.
+// 320 MHz has two overlapping block sets (320-1 and 320-2).
+var blockStarts6 = map[int][]int{
+	40:  {1, 9, 17, 25, 33, 41, 49, 57, 65, 73, 81, 89, 97, 105, 113, 121, 129, 137, 145, 153, 161, 169, 177, 185, 193, 201, 209, 217, 225},
+	80:  {1, 17, 33, 49, 65, 81, 97, 113, 129, 145, 161, 177, 193, 209},
+	160: {1, 33, 65, 97, 129, 161, 193},
+	320: {1, 65, 129, 33, 97, 161},
+}
+
+// opClasses6 maps 6 GHz channel widths to their global operating class
+var opClasses6 = map[int]int{20: 131, 40: 132, 80: 133, 160: 134, 320: 137}
+
+// PlanChannel computes HT40 direction, center segment index and chwidth for
+// a primary channel and width (20/40/80/160 MHz, 320 MHz on 6 GHz) in band
+// ("2.4", "5" or "6"). It returns an error when the channel doesn't fit a
+// valid channel block.
+func PlanChannel(band string, channel, width int) (*ChannelPlan, error) {
+	plan, err := planChannel(band, channel, width)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Width != 320 {
+		plan.EHTCenterSeg0 = plan.CenterSeg0
+		plan.EHTChWidth = plan.ChWidth
+	}
+	return plan, nil
+}
+
+func planChannel(band string, channel, width int) (*ChannelPlan, error) {
+	plan := &ChannelPlan{Band: band, Channel: channel, Width: width}
+
+	switch band {
+	case "2.4":
+		if !containsInt(channels24, channel) {
+			return nil, fmt.Errorf("channel %d is not a 2.4 GHz channel", channel)
+		}
+		switch width {
+		case 20:
+			return plan, nil
+		case 40:
+			// The secondary channel sits 4 channels (20 MHz) above or below
+			switch {
+			case channel == 14:
+				return nil, fmt.Errorf("channel 14 only supports 20 MHz")
+			case channel <= 7 && channel+4 <= 13:
+				plan.HT40 = "+"
+			case channel-4 >= 1:
+				plan.HT40 = "-"
+			default:
+				return nil, fmt.Errorf("channel %d has no 40 MHz secondary channel", channel)
+			}
+			return plan, nil
+		default:
+			return nil, fmt.Errorf("%d MHz is not supported on 2.4 GHz (use 20 or 40)", width)
+		}
+
+	case "5":
+		if !containsInt(channels5, channel) {
+			return nil, fmt.Errorf("channel %d is not a 5 GHz channel", channel)
+		}
+		if width == 20 {
+			return plan, nil
+		}
+
+		starts, ok := blockStarts5[width]
+		if !ok {
+			return nil, fmt.Errorf("unsupported channel width %d MHz (use 20, 40, 80 or 160)", width)
+		}
+
+		// Each block is width/20 channels, 4 channel numbers apart
+		span := (width/20 - 1) * 4
+		for _, start := range starts {
+			if channel < start || channel > start+span {
+				continue
+			}
+			// 40 MHz pairs decide the HT40 direction, also inside 80/160 blocks
+			if (channel-start)%8 == 0 {
+				plan.HT40 = "+"
+			} else {
+				plan.HT40 = "-"
+			}
+			plan.CenterSeg0 = start + span/2
+			switch width {
+			case 80:
+				plan.ChWidth = 1
+			case 160:
+				plan.ChWidth = 2
+			}
+			return plan, nil
+		}
+		return nil, fmt.Errorf("channel %d doesn't fit a %d MHz channel block", channel, width)
+
+	case "6":
+		if !containsInt(channels6, channel) {
+			return nil, fmt.Errorf("channel %d is not a 6 GHz channel", channel)
+		}
+		plan.OpClass = opClasses6[width]
+		if width == 20 {
+			return plan, nil
+		}
+
+		starts, ok := blockStarts6[width]
+		if !ok {
+			return nil, fmt.Errorf("unsupported channel width %d MHz (use 20, 40, 80, 160 or 320)", width)
+		}
+		start, ok := blockStart(starts, channel, width)
+		if !ok {
+			return nil, fmt.Errorf("channel %d doesn't fit a %d MHz channel block", channel, width)
+		}
+
+		span := (width/20 - 1) * 4
+		plan.CenterSeg0 = start + span/2
+		switch width {
+		case 80:
+			plan.ChWidth = 1
+		case 160:
+			plan.ChWidth = 2
+		case 320:
+			// HE can't do 320 MHz, it runs on the 160 MHz half holding the primary
+			plan.EHTCenterSeg0 = plan.CenterSeg0
+			plan.EHTChWidth = 9
+			start160, _ := blockStart(blockStarts6[160], channel, 160)
+			plan.CenterSeg0 = start160 + 14
+			plan.ChWidth = 2
+		}
+		return plan, nil
+	}
+
+	return nil, fmt.Errorf("unknown band %q", band)
+}
+
+// blockStart returns the first channel of the block in starts holding channel
+func blockStart(starts []int, channel, width int) (int, bool) {
+	span := (width/20 - 1) * 4
+	for _, start := range starts {
+		if channel >= start && channel <= start+span {
+			return start, true
+		}
+	}
+	return 0, false
+}
+
+// defaultWidth picks the channel width used when WifiConfig.Width is 0
+func defaultWidth(band string, standard WifiStandard) int {
+	if band == "2.4" {
+		return 20
+	}
+	if standard == Wifi4 && band == "5" {
+		return 40
+	}
+	return 80
+}
+
+// validWidth reports whether width is a supported channel width (0 = default)
+func validWidth(width int) bool {
+	switch width {
+	case 0, 20, 40, 80, 160, 320:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package pkg
+
+import "testing"
+
+func TestPlanChannel(t *testing.T) {
+	tests := []struct {
+		band    string
+		channel int
+		width   int
+		want    *ChannelPlan // nil when the channel is rejected
+	}{
+		{"2.4", 1, 20, &ChannelPlan{}},
+		{"2.4", 1, 40, &ChannelPlan{HT40: "+"}},
+		{"2.4", 7, 40, &ChannelPlan{HT40: "+"}},
+		{"2.4", 8, 40, &ChannelPlan{HT40: "-"}},
+		{"2.4", 13, 40, &ChannelPlan{HT40: "-"}},
+		{"2.4", 14, 40, nil},
+		{"2.4", 6, 80, nil},
+		{"2.4", 36, 20, nil},
+
+		{"5", 36, 20, &ChannelPlan{}},
+		{"5", 36, 40, &ChannelPlan{HT40: "+", CenterSeg0: 38, EHTCenterSeg0: 38}},
+		{"5", 40, 40, &ChannelPlan{HT40: "-", CenterSeg0: 38, EHTCenterSeg0: 38}},
+		{"5", 44, 80, &ChannelPlan{HT40: "+", CenterSeg0: 42, ChWidth: 1, EHTCenterSeg0: 42, EHTChWidth: 1}},
+		{"5", 48, 80, &ChannelPlan{HT40: "-", CenterSeg0: 42, ChWidth: 1, EHTCenterSeg0: 42, EHTChWidth: 1}},
+		{"5", 144, 80, &ChannelPlan{HT40: "-", CenterSeg0: 138, ChWidth: 1, EHTCenterSeg0: 138, EHTChWidth: 1}},
+		{"5", 116, 160, &ChannelPlan{HT40: "+", CenterSeg0: 114, ChWidth: 2, EHTCenterSeg0: 114, EHTChWidth: 2}},
+		{"5", 140, 160, nil},
+		{"5", 6, 20, nil},
+
+		{"6", 37, 20, &ChannelPlan{OpClass: 131}},
+		{"6", 5, 40, &ChannelPlan{CenterSeg0: 3, EHTCenterSeg0: 3, OpClass: 132}},
+		{"6", 37, 80, &ChannelPlan{CenterSeg0: 39, ChWidth: 1, EHTCenterSeg0: 39, EHTChWidth: 1, OpClass: 133}},
+		{"6", 37, 160, &ChannelPlan{CenterSeg0: 47, ChWidth: 2, EHTCenterSeg0: 47, EHTChWidth: 2, OpClass: 134}},
+		// HE runs on the 160 MHz half holding the primary channel
+		{"6", 37, 320, &ChannelPlan{CenterSeg0: 47, ChWidth: 2, EHTCenterSeg0: 31, EHTChWidth: 9, OpClass: 137}},
+		{"6", 69, 320, &ChannelPlan{CenterSeg0: 79, ChWidth: 2, EHTCenterSeg0: 95, EHTChWidth: 9, OpClass: 137}},
+		{"6", 233, 40, nil},
+		{"6", 2, 20, nil},
+
+		{"60", 1, 20, nil},
+	}
+	for _, tt := range tests {
+		got, err := PlanChannel(tt.band, tt.channel, tt.width)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s GHz channel %d %d MHz: got %+v, want an error", tt.band, tt.channel, tt.width, *got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s GHz channel %d %d MHz: %v", tt.band, tt.channel, tt.width, err)
+			continue
+		}
+		want := *tt.want
+		want.Band, want.Channel, want.Width = tt.band, tt.channel, tt.width
+		if *got != want {
+			t.Errorf("%s GHz channel %d %d MHz:\n got %+v\nwant %+v", tt.band, tt.channel, tt.width, *got, want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/wifi"
+)
+
+// DHCPLease is an address handed out by the dnsmasq of the AP
+type DHCPLease struct {
+	MAC      net.HardwareAddr
+	IP       netip.Addr
+	Hostname string    // empty when the client sent none
+	ClientID string    // empty when the client sent none
+	Expiry   time.Time // zero for an infinite lease
+}
+
+// DHCPLeases returns the leases of the dnsmasq on iface, nil when it never
+// handed out an address. The lease file is kept when dnsmasq stops, so a
+// restarted dnsmasq gives clients their previous address.
+func DHCPLeases(iface string) ([]DHCPLease, error) {
+	data, err := os.ReadFile(newRuntimeDir(iface).file(dnsmasqLeaseFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read leases: %v", err)
+	}
+
+	var leases []DHCPLease
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		// IPv6 leases and the "duid" line don't have a MAC, skip them
+		if l, ok := parseLeaseLine(sc.Text()); ok {
+			leases = append(leases, l)
+		}
+	}
+	return leases, nil
+}
+
+// parseLeaseLine parses a line of the dnsmasq lease file:
+// "<expiry> <mac> <ip> <hostname> <client-id>", "*" for an unknown field
+func parseLeaseLine(line string) (DHCPLease, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return DHCPLease{}, false
+	}
+	expiry, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return DHCPLease{}, false
+	}
+	mac, err := net.ParseMAC(fields[1])
+	if err != nil {
+		return DHCPLease{}, false
+	}
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return DHCPLease{}, false
+	}
+
+	l := DHCPLease{MAC: mac, IP: ip}
+	if expiry != 0 {
+		l.Expiry = time.Unix(expiry, 0)
+	}
+	if fields[3] != "*" {
+		l.Hostname = fields[3]
+	}
+	if len(fields) > 4 && fields[4] != "*" {
+		l.ClientID = fields[4]
+	}
+	return l, true
+}
+
+// Client is a device of the AP, associated with it or holding a lease
+type Client struct {
+	MAC net.HardwareAddr
+
+	// Lease is nil when the client got no address from the AP, e.g. with a
+	// static IP or while it still waits for DHCP
+	Lease *DHCPLease
+
+	// Associated is set when the client is connected to a BSS of the AP,
+	// the fields below are only valid then
+	Associated bool
+	Ifname     string        // the BSS interface the client is connected to
+	Signal     int           // dBm of the last received frame
+	RxBitrate  int           // bit/s of the last received frame
+	TxBitrate  int           // bit/s of the last sent frame
+	RxBytes    uint64        // bytes received from the client
+	TxBytes    uint64        // bytes sent to the client
+	Connected  time.Duration // time since the client connected
+	Inactive   time.Duration // time since the last frame of the client
+}
+
+// Clients returns the devices of the AP on iface: every station connected
+// to one of its BSSes joined with its DHCP lease, and the clients with an
+// unexpired lease that are not connected right now. Associated clients
+// come first, each group sorted by IP address.
+func Clients(iface string) ([]Client, error) {
+	stations, err := apStations(iface)
+	if err != nil {
+		return nil, err
+	}
+	leases, err := DHCPLeases(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	byMAC := map[string]*Client{}
+	var clients []*Client
+	for _, sta := range stations {
+		c := &Client{
+			MAC:        sta.HardwareAddr,
+			Associated: true,
+			Ifname:     sta.ifname,
+			Signal:     sta.Signal,
+			RxBitrate:  sta.ReceiveBitrate,
+			TxBitrate:  sta.TransmitBitrate,
+			RxBytes:    uint64(sta.ReceivedBytes),
+			TxBytes:    uint64(sta.TransmittedBytes),
+			Connected:  sta.Connected,
+			Inactive:   sta.Inactive,
+		}
+		byMAC[c.MAC.String()] = c
+		clients = append(clients, c)
+	}
+
+	now := time.Now()
+	for i := range leases {
+		l := &leases[i]
+		if !l.Expiry.IsZero() && l.Expiry.Before(now) {
+			continue
+		}
+		c, ok := byMAC[l.MAC.String()]
+		if !ok {
+			c = &Client{MAC: l.MAC}
+			byMAC[l.MAC.String()] = c
+			clients = append(clients, c)
+		}
+		c.Lease = l
+	}
+
+	sort.SliceStable(clients, func(i, j int) bool {
+		a, b := clients[i], clients[j]
+		if a.Associated != b.Associated {
+			return a.Associated
+		}
+		if (a.Lease == nil) != (b.Lease == nil) {
+			return a.Lease != nil
+		}
+		if a.Lease != nil && a.Lease.IP != b.Lease.IP {
+			return a.Lease.IP.Less(b.Lease.IP)
+		}
+		return bytes.Compare(a.MAC, b.MAC) < 0
+	})
+
+	result := make([]Client, len(clients))
+	for i, c := range clients {
+		result[i] = *c
+	}
+	return result, nil
+}
+
+// apStation is the nl80211 station info with the name of its BSS interface
+type apStation struct {
+	*wifi.StationInfo
+	ifname string
+}
+
+// apStations returns the stations of every BSS of the AP on iface. The BSS
+// interfaces are the sockets in the hostapd control directory, iface alone
+// when hostapd doesn't run.
+func apStations(iface string) ([]apStation, error) {
+	names := []string{iface}
+	if entries, err := os.ReadDir(HostapdCtrlDir(iface)); err == nil {
+		for _, e := range entries {
+			if e.Name() != iface {
+				names = append(names, e.Name())
+			}
+		}
+	}
+
+	c, err := wifi.New()
+	if err != nil {
+		return nil, fmt.Errorf("error open connection wifi: %v", err)
+	}
+	defer c.Close()
+
+	ifaces, err := c.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("error listing interfaces: %v", err)
+	}
+	byName := map[string]*wifi.Interface{}
+	for _, ifi := range ifaces {
+		byName[ifi.Name] = ifi
+	}
+	if byName[iface] == nil {
+		return nil, fmt.Errorf("interface not found %s", iface)
+	}
+
+	var stations []apStation
+	for _, name := range names {
+		ifi := byName[name]
+		if ifi == nil {
+			continue
+		}
+		infos, err := c.StationInfo(ifi)
+		if err != nil {
+			// An interface without stations reports "not exist" on some kernels
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("could not get stations of %s: %v", name, err)
+		}
+		for _, info := range infos {
+			stations = append(stations, apStation{StationInfo: info, ifname: name})
+		}
+	}
+	return stations, nil
+}
@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLeaseLine(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := netip.MustParseAddr("192.168.107.23")
+	tests := []struct {
+		line string
+		want DHCPLease
+		ok   bool
+	}{
+		{"1700000000 aa:bb:cc:dd:ee:ff 192.168.107.23 laptop 01:aa:bb:cc:dd:ee:ff",
+			DHCPLease{MAC: mac, IP: ip, Hostname: "laptop", ClientID: "01:aa:bb:cc:dd:ee:ff", Expiry: time.Unix(1700000000, 0)}, true},
+		{"1700000000 aa:bb:cc:dd:ee:ff 192.168.107.23 * *",
+			DHCPLease{MAC: mac, IP: ip, Expiry: time.Unix(1700000000, 0)}, true},
+		// An infinite lease has expiry 0
+		{"0 aa:bb:cc:dd:ee:ff 192.168.107.23 laptop *",
+			DHCPLease{MAC: mac, IP: ip, Hostname: "laptop"}, true},
+		{"1700000000 aa:bb:cc:dd:ee:ff 192.168.107.23 laptop",
+			DHCPLease{MAC: mac, IP: ip, Hostname: "laptop", Expiry: time.Unix(1700000000, 0)}, true},
+		{"duid 00:01:00:01:2c:5f:3a:1b:aa:bb:cc:dd:ee:ff", DHCPLease{}, false},
+		// IPv6 leases have an IAID instead of a MAC
+		{"1700000000 1234567 fd00::23 laptop 00:01:00:01", DHCPLease{}, false},
+		{"soon aa:bb:cc:dd:ee:ff 192.168.107.23 laptop *", DHCPLease{}, false},
+		{"1700000000 aa:bb:cc:dd:ee:ff 192.168.107 laptop *", DHCPLease{}, false},
+		{"1700000000 aa:bb:cc:dd:ee:ff", DHCPLease{}, false},
+		{"", DHCPLease{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseLeaseLine(tt.line)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLeaseLine(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
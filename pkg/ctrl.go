@@ -0,0 +1,365 @@
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hostapdCtrlDir is the ctrl_interface directory inside the runtime
+// directory, hostapd creates one socket per BSS named after its interface
+const hostapdCtrlDir = "hostapd_ctrl"
+
+// ctrlTimeout bounds how long a control request waits for hostapd's reply
+const ctrlTimeout = 5 * time.Second
+
+// ctrlReplySize fits the largest replies (STATUS with several BSSes, ALL_STA)
+const ctrlReplySize = 16384
+
+// HostapdCtrlDir returns the control socket directory of the hostapd
+// started by StartHostapd on ifaceName
+func HostapdCtrlDir(ifaceName string) string {
+	return newRuntimeDir(ifaceName).file(hostapdCtrlDir)
+}
+
+// HostapdClient talks to a running hostapd over its control interface
+// (UNIX datagram socket), like hostapd_cli does
+type HostapdClient struct {
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// ctrlSeq makes the local socket names of a process unique
+var ctrlSeq atomic.Uint64
+
+// DialHostapd connects to the control interface of the main BSS of the
+// hostapd started on ifaceName
+func DialHostapd(ifaceName string) (*HostapdClient, error) {
+	return DialHostapdSocket(filepath.Join(HostapdCtrlDir(ifaceName), ifaceName))
+}
+
+// DialHostapdSocket connects to a hostapd control socket. Additional BSSes
+// have their own socket in HostapdCtrlDir named after the BSS interface.
+func DialHostapdSocket(path string) (*HostapdClient, error) {
+	// hostapd replies to the sender address, an abstract socket needs no cleanup
+	local := &net.UnixAddr{
+		Name: fmt.Sprintf("@wifigo-ctrl-%d-%d", os.Getpid(), ctrlSeq.Add(1)),
+		Net:  "unixgram",
+	}
+	remote := &net.UnixAddr{Name: path, Net: "unixgram"}
+
+	conn, err := net.DialUnix("unixgram", local, remote)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to hostapd at %s: %v", path, err)
+	}
+	return &HostapdClient{conn: conn}, nil
+}
+
+// Close closes the connection
+func (c *HostapdClient) Close() error {
+	return c.conn.Close()
+}
+
+// Request sends a raw control command and returns hostapd's reply.
+// A "FAIL" or "UNKNOWN COMMAND" reply is returned as an error.
+func (c *HostapdClient) Request(cmd string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.conn.SetDeadline(time.Now().Add(ctrlTimeout)); err != nil {
+		return "", err
+	}
+	if _, err := c.conn.Write([]byte(cmd)); err != nil {
+		return "", fmt.Errorf("hostapd %s: %v", cmd, err)
+	}
+
+	buf := make([]byte, ctrlReplySize)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return "", fmt.Errorf("hostapd %s: %v", cmd, err)
+		}
+		reply := string(buf[:n])
+		// Skip unsolicited events ("<3>AP-STA-CONNECTED ...") of an attached socket
+		if strings.HasPrefix(reply, "<") {
+			continue
+		}
+		switch strings.TrimSpace(reply) {
+		case "FAIL", "UNKNOWN COMMAND":
+			return "", fmt.Errorf("hostapd %s: %s", cmd, strings.TrimSpace(reply))
+		}
+		return reply, nil
+	}
+}
+
+// Ping checks that hostapd answers
+func (c *HostapdClient) Ping() error {
+	reply, err := c.Request("PING")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(reply) != "PONG" {
+		return fmt.Errorf("unexpected PING reply %q", reply)
+	}
+	return nil
+}
+
+// HostapdStatus is the reply of the STATUS command
+type HostapdStatus struct {
+	State            string // ENABLED, DISABLED, COUNTRY_UPDATE, ACS, HT_SCAN, DFS, ...
+	Channel          int
+	Freq             int // MHz
+	SecondaryChannel int // -1, 0 or 1
+	IEEE80211N       bool
+	IEEE80211AC      bool
+	IEEE80211AX      bool
+	IEEE80211BE      bool
+	BSS              []BSSStatus
+
+	Raw map[string]string // every key=value of the reply
+}
+
+// BSSStatus is the state of one BSS in the STATUS reply
+type BSSStatus struct {
+	Ifname      string
+	BSSID       net.HardwareAddr
+	SSID        string
+	NumStations int
+}
+
+// Status returns the state of the radio and its BSSes
+func (c *HostapdClient) Status() (*HostapdStatus, error) {
+	reply, err := c.Request("STATUS")
+	if err != nil {
+		return nil, err
+	}
+	kv := parseKeyValues(reply)
+
+	st := &HostapdStatus{
+		State:            kv["state"],
+		Channel:          atoi(kv["channel"]),
+		Freq:             atoi(kv["freq"]),
+		SecondaryChannel: atoi(kv["secondary_channel"]),
+		IEEE80211N:       kv["ieee80211n"] == "1",
+		IEEE80211AC:      kv["ieee80211ac"] == "1",
+		IEEE80211AX:      kv["ieee80211ax"] == "1",
+		IEEE80211BE:      kv["ieee80211be"] == "1",
+		Raw:              kv,
+	}
+	for i := 0; ; i++ {
+		idx := "[" + strconv.Itoa(i) + "]"
+		ifname, ok := kv["bss"+idx]
+		if !ok {
+			break
+		}
+		bssid, _ := net.ParseMAC(kv["bssid"+idx])
+		st.BSS = append(st.BSS, BSSStatus{
+			Ifname:      ifname,
+			BSSID:       bssid,
+			SSID:        kv["ssid"+idx],
+			NumStations: atoi(kv["num_sta"+idx]),
+		})
+	}
+	return st, nil
+}
+
+// Station is a client associated with the AP as reported by hostapd
+type Station struct {
+	MAC       net.HardwareAddr
+	Flags     []string // e.g. AUTH, ASSOC, AUTHORIZED, WMM, HT, VHT, HE
+	AID       int
+	RxBytes   uint64
+	TxBytes   uint64
+	RxPackets uint64
+	TxPackets uint64
+	Signal    int // dBm, 0 if unknown
+	RxRate    int // kbit/s of the last received frame, 0 if unknown
+	TxRate    int // kbit/s of the last sent frame, 0 if unknown
+	Inactive  time.Duration
+	Connected time.Duration
+
+	Raw map[string]string // every key=value of the reply
+}
+
+// HasFlag reports whether hostapd lists flag (without brackets) for the station
+func (s *Station) HasFlag(flag string) bool {
+	for _, f := range s.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorized reports whether the station completed authentication (4-way handshake or 802.1X)
+func (s *Station) Authorized() bool {
+	return s.HasFlag("AUTHORIZED")
+}
+
+// Station returns a single station by MAC
+func (c *HostapdClient) Station(mac net.HardwareAddr) (*Station, error) {
+	reply, err := c.Request("STA " + mac.String())
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(reply) == "" {
+		return nil, fmt.Errorf("station %s not found", mac)
+	}
+	return parseStation(reply)
+}
+
+// Stations walks the station list with STA-FIRST / STA-NEXT
+func (c *HostapdClient) Stations() ([]*Station, error) {
+	var stations []*Station
+	reply, err := c.Request("STA-FIRST")
+	for err == nil && strings.TrimSpace(reply) != "" {
+		sta, perr := parseStation(reply)
+		if perr != nil {
+			return nil, perr
+		}
+		stations = append(stations, sta)
+		reply, err = c.Request("STA-NEXT " + sta.MAC.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stations, nil
+}
+
+// AllStations returns every station in one ALL_STA request. hostapd cuts
+// the reply when it doesn't fit its buffer, Stations has no such limit.
+func (c *HostapdClient) AllStations() ([]*Station, error) {
+	reply, err := c.Request("ALL_STA")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each station starts with a line holding only its MAC address
+	var stations []*Station
+	var block []string
+	flush := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+		sta, err := parseStation(strings.Join(block, "\n"))
+		if err != nil {
+			return err
+		}
+		stations = append(stations, sta)
+		block = nil
+		return nil
+	}
+	for _, line := range strings.Split(reply, "\n") {
+		if _, err := net.ParseMAC(strings.TrimSpace(line)); err == nil {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		if line != "" {
+			block = append(block, line)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return stations, nil
+}
+
+// parseStation parses a STA / STA-FIRST / STA-NEXT reply
+func parseStation(reply string) (*Station, error) {
+	first, rest, _ := strings.Cut(reply, "\n")
+	mac, err := net.ParseMAC(strings.TrimSpace(first))
+	if err != nil {
+		return nil, fmt.Errorf("invalid station reply %q", first)
+	}
+	kv := parseKeyValues(rest)
+
+	sta := &Station{
+		MAC:       mac,
+		AID:       atoi(kv["aid"]),
+		RxBytes:   atou(kv["rx_bytes"]),
+		TxBytes:   atou(kv["tx_bytes"]),
+		RxPackets: atou(kv["rx_packets"]),
+		TxPackets: atou(kv["tx_packets"]),
+		Signal:    atoi(kv["signal"]),
+		Inactive:  time.Duration(atoi(kv["inactive_msec"])) * time.Millisecond,
+		Connected: time.Duration(atoi(kv["connected_time"])) * time.Second,
+		Raw:       kv,
+	}
+	// Rates are in 100 kbit/s, followed by MCS details: "rx_rate_info=1201 vhtmcs 9 ..."
+	if f := strings.Fields(kv["rx_rate_info"]); len(f) > 0 {
+		sta.RxRate = atoi(f[0]) * 100
+	}
+	if f := strings.Fields(kv["tx_rate_info"]); len(f) > 0 {
+		sta.TxRate = atoi(f[0]) * 100
+	}
+	// flags=[AUTH][ASSOC][AUTHORIZED]
+	for _, f := range strings.Split(kv["flags"], "]") {
+		if f = strings.TrimPrefix(f, "["); f != "" {
+			sta.Flags = append(sta.Flags, f)
+		}
+	}
+	return sta, nil
+}
+
+// HostapdRunningConfig is the reply of GET_CONFIG, the security settings hostapd runs with
+type HostapdRunningConfig struct {
+	BSSID           net.HardwareAddr
+	SSID            string
+	WPSState        string
+	WPA             int      // 0 open, 2 WPA2/RSN
+	KeyMgmt         []string // e.g. WPA-PSK, SAE, OWE, WPA-EAP
+	GroupCipher     string
+	PairwiseCiphers []string
+
+	Raw map[string]string // every key=value of the reply
+}
+
+// Config returns the configuration of the BSS
+func (c *HostapdClient) Config() (*HostapdRunningConfig, error) {
+	reply, err := c.Request("GET_CONFIG")
+	if err != nil {
+		return nil, err
+	}
+	kv := parseKeyValues(reply)
+
+	bssid, _ := net.ParseMAC(kv["bssid"])
+	return &HostapdRunningConfig{
+		BSSID:           bssid,
+		SSID:            kv["ssid"],
+		WPSState:        kv["wps_state"],
+		WPA:             atoi(kv["wpa"]),
+		KeyMgmt:         strings.Fields(kv["key_mgmt"]),
+		GroupCipher:     kv["group_cipher"],
+		PairwiseCiphers: strings.Fields(kv["rsn_pairwise_cipher"]),
+		Raw:             kv,
+	}, nil
+}
+
+// parseKeyValues parses the key=value lines of a control reply
+func parseKeyValues(reply string) map[string]string {
+	kv := map[string]string{}
+	for _, line := range strings.Split(reply, "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			kv[k] = v
+		}
+	}
+	return kv
+}
+
+// atoi and atou parse numbers of control replies, 0 when missing or invalid
+func atoi(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+func atou(s string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	return n
+}
@@ -0,0 +1,320 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DFSState is the radar detection state of the AP channel
+type DFSState string
+
+const (
+	DFSInactive  DFSState = "inactive"       // channel doesn't need radar detection
+	DFSCAC       DFSState = "cac"            // channel availability check running, AP not beaconing yet
+	DFSAvailable DFSState = "available"      // CAC passed, AP is up on the DFS channel
+	DFSRadar     DFSState = "radar-detected" // radar hit, the AP has to leave the channel
+	DFSMoved     DFSState = "moved"          // AP moved to the non-DFS fallback channel
+)
+
+// DFS event names as printed by hostapd
+const (
+	dfsEventCACStart     = "DFS-CAC-START"
+	dfsEventCACCompleted = "DFS-CAC-COMPLETED"
+	dfsEventRadar        = "DFS-RADAR-DETECTED"
+	dfsEventNewChannel   = "DFS-NEW-CHANNEL"
+	dfsEventNOPFinished  = "DFS-NOP-FINISHED"
+)
+
+// defaultCACTime is used when hostapd doesn't report the CAC duration
+const defaultCACTime = 60 * time.Second
+
+// dfsMoveDelay is how long the monitor leaves hostapd after a radar hit to
+// switch to a clear channel by itself before it moves the AP to the fallback
+const dfsMoveDelay = 2 * time.Second
+
+// DFSEvent is one DFS event reported by hostapd
+type DFSEvent struct {
+	Type    string // DFS-CAC-START, DFS-CAC-COMPLETED, DFS-RADAR-DETECTED, ...
+	Freq    int    // MHz
+	Channel int
+	Success bool          // DFS-CAC-COMPLETED only
+	CACTime time.Duration // DFS-CAC-START only
+	Time    time.Time
+}
+
+// DFSStatus is a snapshot of the DFS state of a running AP
+type DFSStatus struct {
+	State           DFSState
+	Channel         int
+	FallbackChannel int
+	CACStarted      time.Time
+	CACTime         time.Duration
+}
+
+// CACRemaining returns how long the running CAC still takes, 0 when none is running
+func (s DFSStatus) CACRemaining() time.Duration {
+	if s.State != DFSCAC {
+		return 0
+	}
+	left := s.CACTime - time.Since(s.CACStarted)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// CACProgress returns the progress of the running CAC between 0 and 1
+func (s DFSStatus) CACProgress() float64 {
+	switch s.State {
+	case DFSCAC:
+		if s.CACTime <= 0 {
+			return 0
+		}
+		p := float64(time.Since(s.CACStarted)) / float64(s.CACTime)
+		if p > 1 {
+			p = 1
+		}
+		return p
+	case DFSInactive:
+		return 0
+	}
+	return 1
+}
+
+// DFSMonitor follows the DFS events of hostapd's control interface.
+// StartHostapd attaches one when the channel needs radar detection and
+// stores it in WifiConfig.DFS. On radar it moves the AP to the fallback
+// channel unless hostapd already switched to a non-DFS channel.
+type DFSMonitor struct {
+	mu     sync.Mutex
+	status DFSStatus
+	events chan DFSEvent
+
+	// move switches the AP to a non-DFS channel, nil when no fallback exists
+	move func(channel int) error
+	// pending runs move after dfsMoveDelay, nil when no move is scheduled
+	pending *time.Timer
+}
+
+func newDFSMonitor(channel, fallback int, cacTime time.Duration, move func(channel int) error) *DFSMonitor {
+	return &DFSMonitor{
+		status: DFSStatus{
+			State:           DFSCAC,
+			Channel:         channel,
+			FallbackChannel: fallback,
+			CACStarted:      time.Now(),
+			CACTime:         cacTime,
+		},
+		events: make(chan DFSEvent, 16),
+		move:   move,
+	}
+}
+
+// Status returns the current DFS state
+func (m *DFSMonitor) Status() DFSStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Events delivers every DFS event. Events are dropped when nobody reads them.
+func (m *DFSMonitor) Events() <-chan DFSEvent {
+	return m.events
+}
+
+// follow feeds the monitor with the DFS events of the hostapd on ifaceName
+// until ctx is canceled. It attaches as soon as hostapd created its control
+// interface, the monitor starts in DFSCAC so a missed CAC start is harmless.
+func (m *DFSMonitor) follow(ctx context.Context, ifaceName string) {
+	defer m.cancelMove()
+
+	var events <-chan Event
+	for {
+		var err error
+		if events, err = SubscribeHostapdEvents(ctx, ifaceName); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(readyPollInterval):
+		}
+	}
+	for ev := range events {
+		if ev.DFS != nil {
+			m.handle(*ev.DFS)
+		}
+	}
+}
+
+func (m *DFSMonitor) handle(ev DFSEvent) {
+	m.mu.Lock()
+	radar := false
+	switch ev.Type {
+	case dfsEventCACStart:
+		m.status.State = DFSCAC
+		m.status.Channel = ev.Channel
+		m.status.CACStarted = ev.Time
+		m.status.CACTime = ev.CACTime
+		fmt.Printf("DFS: channel availability check on channel %d, the AP starts in %s\n", ev.Channel, ev.CACTime)
+	case dfsEventCACCompleted:
+		if ev.Success {
+			m.status.State = DFSAvailable
+			fmt.Printf("DFS: channel availability check on channel %d passed\n", m.status.Channel)
+		} else {
+			m.status.State = DFSRadar
+			radar = true
+			fmt.Printf("WARNING: DFS channel availability check on channel %d failed\n", m.status.Channel)
+		}
+	case dfsEventRadar:
+		m.status.State = DFSRadar
+		radar = true
+		fmt.Printf("WARNING: radar detected on channel %d\n", ev.Channel)
+	case dfsEventNewChannel:
+		m.status.Channel = ev.Channel
+		if !isDFSChannel(ev.Channel) {
+			// hostapd found a clear channel by itself, nothing left to do
+			m.status.State = DFSMoved
+			m.stopPending()
+		}
+	}
+	// Only move once, later radar events come from hostapd's own channel switch.
+	// The move runs later on its own goroutine so hostapd can finish its switch.
+	if radar && m.move != nil && m.status.State != DFSMoved && m.pending == nil {
+		fallback := m.status.FallbackChannel
+		m.pending = time.AfterFunc(dfsMoveDelay, func() { m.moveTo(fallback) })
+	}
+	m.mu.Unlock()
+
+	select {
+	case m.events <- ev:
+	default:
+	}
+}
+
+// moveTo switches the AP to the fallback channel unless hostapd left the
+// DFS channel in the meantime
+func (m *DFSMonitor) moveTo(channel int) {
+	m.mu.Lock()
+	m.pending = nil
+	if m.status.State == DFSMoved {
+		m.mu.Unlock()
+		return
+	}
+	move := m.move
+	m.mu.Unlock()
+
+	fmt.Printf("DFS: moving to non-DFS channel %d\n", channel)
+	if err := move(channel); err != nil {
+		fmt.Printf("WARNING: could not move to channel %d: %v\n", channel, err)
+		return
+	}
+	m.mu.Lock()
+	m.status.State = DFSMoved
+	m.status.Channel = channel
+	m.mu.Unlock()
+}
+
+// cancelMove drops a scheduled move, the AP stopped
+func (m *DFSMonitor) cancelMove() {
+	m.mu.Lock()
+	m.stopPending()
+	m.mu.Unlock()
+}
+
+func (m *DFSMonitor) stopPending() {
+	if m.pending != nil {
+		m.pending.Stop()
+		m.pending = nil
+	}
+}
+
+// parseDFSEvent parses a hostapd line like
+// "wlan0: DFS-CAC-START freq=5260 chan=52 chan_offset=0 width=1 seg0=58 seg1=0 cac_time=60s"
+func parseDFSEvent(line string) (DFSEvent, bool) {
+	i := strings.Index(line, "DFS-")
+	if i < 0 {
+		return DFSEvent{}, false
+	}
+	fields := strings.Fields(line[i:])
+	ev := DFSEvent{Type: fields[0], Time: time.Now()}
+	switch ev.Type {
+	case dfsEventCACStart, dfsEventCACCompleted, dfsEventRadar, dfsEventNewChannel, dfsEventNOPFinished:
+	default:
+		return DFSEvent{}, false
+	}
+
+	for _, f := range fields[1:] {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "freq":
+			ev.Freq, _ = strconv.Atoi(v)
+		case "chan":
+			ev.Channel, _ = strconv.Atoi(v)
+		case "success":
+			ev.Success = v == "1"
+		case "cac_time":
+			if d, err := time.ParseDuration(v); err == nil {
+				ev.CACTime = d
+			}
+		}
+	}
+	if ev.Channel == 0 && ev.Freq != 0 {
+		_, ev.Channel = freqToChannel(ev.Freq)
+	}
+	if ev.Type == dfsEventCACStart && ev.CACTime == 0 {
+		ev.CACTime = defaultCACTime
+	}
+	return ev, true
+}
+
+// isDFSChannel reports whether a 5 GHz channel needs radar detection in most countries
+func isDFSChannel(channel int) bool {
+	return containsInt(channels5DFS, channel)
+}
+
+// dfsFallbackChannel picks the non-DFS channel and width used after a radar
+// hit: the configured channel or the first auto-selection candidate clear of
+// DFS, shrinking the width until one fits. It returns 0 if none.
+func dfsFallbackChannel(config *WifiConfig, width int) (int, int) {
+	candidates := acsCandidates5
+	if config.DFSFallbackChannel != 0 {
+		candidates = []int{config.DFSFallbackChannel}
+	}
+	for ; width >= 20; width /= 2 {
+		for _, ch := range candidates {
+			plan, err := PlanChannel("5", ch, width)
+			if err != nil || isDFSPlan(config.Regulatory, plan, config.Standard) {
+				continue
+			}
+			if config.Regulatory != nil {
+				if _, err := config.Regulatory.CheckChannel(plan, config.Standard, config.TxPower); err != nil {
+					continue
+				}
+			}
+			return ch, width
+		}
+	}
+	return 0, 0
+}
+
+// expectedCACTime returns the CAC duration the regulatory rules require for a plan
+func expectedCACTime(reg *RegDomain, plan *ChannelPlan) time.Duration {
+	cac := defaultCACTime
+	if reg == nil {
+		return cac
+	}
+	for _, ch := range channelBlock(plan) {
+		if rule := reg.ruleFor(channelToFreq(plan.Band, ch)); rule != nil && rule.CACTime > cac {
+			cac = rule.CACTime
+		}
+	}
+	return cac
+}
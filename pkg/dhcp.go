@@ -0,0 +1,180 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// DHCPConfig is the address pool dnsmasq hands out on the AP
+type DHCPConfig struct {
+	// Prefix is the address of the AP and its subnet, e.g. 192.168.107.1/24.
+	// The address is the clients' gateway and DNS server.
+	Prefix netip.Prefix
+
+	RangeStart netip.Addr    // optional, the first address after the gateway if unset
+	RangeEnd   netip.Addr    // optional, the last address before broadcast if unset
+	LeaseTime  time.Duration // optional, 12h if 0, at least 2 minutes
+	MaxLeases  int           // optional, dnsmasq's default (1000) if 0
+
+	// Reservations give clients a fixed address, inside or outside the
+	// range. Change them at runtime with AddDHCPReservation.
+	Reservations []DHCPReservation
+
+	// DNS is optional, without it dnsmasq forwards the clients' queries
+	// to the servers in /etc/resolv.conf
+	DNS *DNSConfig
+
+	// Logger receives dnsmasq's output as structured records like
+	// WifiConfig.Logger - optional, slog.Default() if nil
+	Logger *slog.Logger
+}
+
+// defaultLeaseTime is the lease time when DHCPConfig.LeaseTime is 0
+const defaultLeaseTime = 12 * time.Hour
+
+// minLeaseTime is the shortest lease dnsmasq hands out
+const minLeaseTime = 2 * time.Minute
+
+// Gateway returns the address of the AP
+func (c *DHCPConfig) Gateway() netip.Addr {
+	return c.Prefix.Addr()
+}
+
+// Network returns the network address of the subnet
+func (c *DHCPConfig) Network() netip.Addr {
+	return c.Prefix.Masked().Addr()
+}
+
+// Netmask returns the subnet mask, e.g. 255.255.255.0
+func (c *DHCPConfig) Netmask() netip.Addr {
+	return uint32ToAddr(^uint32(0) << (32 - c.Prefix.Bits()))
+}
+
+// Broadcast returns the broadcast address of the subnet
+func (c *DHCPConfig) Broadcast() netip.Addr {
+	return uint32ToAddr(addrToUint32(c.Network()) | ^addrToUint32(c.Netmask()))
+}
+
+// Range returns the first and last address handed out. Without an explicit
+// range it spans the addresses after the gateway, or before it when the
+// gateway is the last usable address.
+func (c *DHCPConfig) Range() (netip.Addr, netip.Addr) {
+	gw := c.Gateway()
+	first, last := c.Network().Next(), c.Broadcast().Prev()
+	start, end := c.RangeStart, c.RangeEnd
+	if !start.IsValid() {
+		start = gw.Next()
+		if gw == last {
+			start = first
+		}
+	}
+	if !end.IsValid() {
+		end = last
+		if gw == last || gw.Compare(start) > 0 {
+			end = gw.Prev()
+		}
+	}
+	return start, end
+}
+
+// Validate checks that the pool fits the subnet and leaves out the gateway,
+// network and broadcast addresses
+func (c *DHCPConfig) Validate() error {
+	v := &ValidationError{}
+	if !c.Prefix.IsValid() || !c.Prefix.Addr().Is4() {
+		v.add("dhcp.prefix", "must be an IPv4 address with prefix length, e.g. 192.168.107.1/24")
+		return v.err()
+	}
+	if c.Prefix.Bits() > 30 {
+		v.add("dhcp.prefix", "/%d leaves no addresses for clients, use /30 or shorter", c.Prefix.Bits())
+		return v.err()
+	}
+	gw := c.Gateway()
+	if gw == c.Network() || gw == c.Broadcast() {
+		v.add("dhcp.prefix", "%s is the network or broadcast address of %s", gw, c.Prefix.Masked())
+	}
+
+	start, end := c.Range()
+	for _, r := range []struct {
+		field string
+		addr  netip.Addr
+	}{{"dhcp.range_start", start}, {"dhcp.range_end", end}} {
+		switch {
+		case !r.addr.Is4():
+			v.add(r.field, "%s is not an IPv4 address", r.addr)
+		case !c.Prefix.Contains(r.addr):
+			v.add(r.field, "%s is outside %s", r.addr, c.Prefix.Masked())
+		case r.addr == c.Network() || r.addr == c.Broadcast():
+			v.add(r.field, "%s is the network or broadcast address", r.addr)
+		}
+	}
+	if start.Is4() && end.Is4() {
+		if start.Compare(end) > 0 {
+			v.add("dhcp.range", "start %s is after end %s", start, end)
+		} else if gw.Compare(start) >= 0 && gw.Compare(end) <= 0 {
+			v.add("dhcp.range", "%s-%s includes the gateway %s", start, end, gw)
+		}
+	}
+
+	if c.LeaseTime != 0 && c.LeaseTime < minLeaseTime {
+		v.add("dhcp.lease_time", "must be at least %s", minLeaseTime)
+	}
+	if c.MaxLeases < 0 {
+		v.add("dhcp.max_leases", "must not be negative")
+	}
+	c.validateReservations(v)
+	if c.DNS != nil {
+		c.DNS.validate(v)
+	}
+	return v.err()
+}
+
+// dnsmasqArgs returns the dnsmasq options of the pool
+func (c *DHCPConfig) dnsmasqArgs() []string {
+	start, end := c.Range()
+	lease := c.LeaseTime
+	if lease == 0 {
+		lease = defaultLeaseTime
+	}
+	gw := c.Gateway().String()
+
+	args := []string{
+		"--listen-address=" + gw,
+		fmt.Sprintf("--dhcp-range=%s,%s,%s,%s,%s", start, end, c.Netmask(), c.Broadcast(), dnsmasqDuration(lease)),
+		"--dhcp-option=option:router," + gw,
+		"--dhcp-option=option:dns-server," + gw,
+	}
+	if c.MaxLeases > 0 {
+		args = append(args, "--dhcp-lease-max="+strconv.Itoa(c.MaxLeases))
+	}
+	if c.DNS != nil {
+		args = append(args, c.DNS.dnsmasqArgs()...)
+	}
+	return args
+}
+
+// dnsmasqDuration formats a lease time as dnsmasq expects it: 12h, 45m or seconds
+func dnsmasqDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	case d%time.Minute == 0:
+		return strconv.Itoa(int(d/time.Minute)) + "m"
+	}
+	return strconv.Itoa(int(d / time.Second))
+}
+
+func addrToUint32(a netip.Addr) uint32 {
+	b := a.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func uint32ToAddr(n uint32) netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+	return netip.AddrFrom4(b)
+}
@@ -0,0 +1,159 @@
+package pkg
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// invalidFields returns the fields of a *ValidationError, nil for a nil error
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error %T is not a *ValidationError: %v", err, err)
+	}
+	var fields []string
+	for _, fe := range verr.Errors {
+		fields = append(fields, fe.Field)
+	}
+	return fields
+}
+
+func TestDHCPConfigRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    DHCPConfig
+		start     string
+		end       string
+		broadcast string
+		netmask   string
+	}{
+		{"gateway first", DHCPConfig{Prefix: netip.MustParsePrefix("192.168.107.1/24")},
+			"192.168.107.2", "192.168.107.254", "192.168.107.255", "255.255.255.0"},
+		{"gateway last", DHCPConfig{Prefix: netip.MustParsePrefix("192.168.107.254/24")},
+			"192.168.107.1", "192.168.107.253", "192.168.107.255", "255.255.255.0"},
+		{"gateway in the middle", DHCPConfig{Prefix: netip.MustParsePrefix("10.0.0.100/24")},
+			"10.0.0.101", "10.0.0.254", "10.0.0.255", "255.255.255.0"},
+		{"start below gateway", DHCPConfig{
+			Prefix:     netip.MustParsePrefix("10.0.0.100/24"),
+			RangeStart: netip.MustParseAddr("10.0.0.50"),
+		}, "10.0.0.50", "10.0.0.99", "10.0.0.255", "255.255.255.0"},
+		{"explicit range", DHCPConfig{
+			Prefix:     netip.MustParsePrefix("172.16.0.1/16"),
+			RangeStart: netip.MustParseAddr("172.16.1.0"),
+			RangeEnd:   netip.MustParseAddr("172.16.1.255"),
+		}, "172.16.1.0", "172.16.1.255", "172.16.255.255", "255.255.0.0"},
+		{"/30", DHCPConfig{Prefix: netip.MustParsePrefix("10.0.0.1/30")},
+			"10.0.0.2", "10.0.0.2", "10.0.0.3", "255.255.255.252"},
+	}
+	for _, tt := range tests {
+		start, end := tt.config.Range()
+		if start.String() != tt.start || end.String() != tt.end {
+			t.Errorf("%s: range %s-%s, want %s-%s", tt.name, start, end, tt.start, tt.end)
+		}
+		if b := tt.config.Broadcast().String(); b != tt.broadcast {
+			t.Errorf("%s: broadcast %s, want %s", tt.name, b, tt.broadcast)
+		}
+		if m := tt.config.Netmask().String(); m != tt.netmask {
+			t.Errorf("%s: netmask %s, want %s", tt.name, m, tt.netmask)
+		}
+	}
+}
+
+func TestDHCPConfigValidate(t *testing.T) {
+	prefix := netip.MustParsePrefix("192.168.107.1/24")
+	addr := netip.MustParseAddr
+	tests := []struct {
+		name   string
+		config DHCPConfig
+		fields []string
+	}{
+		{"defaults", DHCPConfig{Prefix: prefix}, nil},
+		{"explicit range", DHCPConfig{Prefix: prefix, RangeStart: addr("192.168.107.100"), RangeEnd: addr("192.168.107.199")}, nil},
+		{"no prefix", DHCPConfig{}, []string{"dhcp.prefix"}},
+		{"ipv6 prefix", DHCPConfig{Prefix: netip.MustParsePrefix("fd00::1/64")}, []string{"dhcp.prefix"}},
+		{"/31", DHCPConfig{Prefix: netip.MustParsePrefix("10.0.0.0/31")}, []string{"dhcp.prefix"}},
+		{"gateway is the network", DHCPConfig{Prefix: netip.MustParsePrefix("192.168.107.0/24")}, []string{"dhcp.prefix"}},
+		{"end outside the subnet", DHCPConfig{Prefix: prefix, RangeEnd: addr("192.168.108.10")}, []string{"dhcp.range_end"}},
+		{"broadcast in range", DHCPConfig{Prefix: prefix, RangeStart: addr("192.168.107.255"), RangeEnd: addr("192.168.107.255")},
+			[]string{"dhcp.range_start", "dhcp.range_end"}},
+		{"ipv6 start", DHCPConfig{Prefix: prefix, RangeStart: addr("fd00::2")}, []string{"dhcp.range_start"}},
+		{"start after end", DHCPConfig{Prefix: prefix, RangeStart: addr("192.168.107.200"), RangeEnd: addr("192.168.107.100")},
+			[]string{"dhcp.range"}},
+		{"range includes the gateway", DHCPConfig{
+			Prefix:     netip.MustParsePrefix("192.168.107.100/24"),
+			RangeStart: addr("192.168.107.50"),
+			RangeEnd:   addr("192.168.107.150"),
+		}, []string{"dhcp.range"}},
+		{"short lease", DHCPConfig{Prefix: prefix, LeaseTime: time.Minute}, []string{"dhcp.lease_time"}},
+		{"negative max leases", DHCPConfig{Prefix: prefix, MaxLeases: -1}, []string{"dhcp.max_leases"}},
+		{"dns errors are included", DHCPConfig{Prefix: prefix, DNS: &DNSConfig{Domain: "-lan"}}, []string{"dns.domain"}},
+	}
+	for _, tt := range tests {
+		fields := invalidFields(t, tt.config.Validate())
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: invalid fields %v, want %v", tt.name, fields, tt.fields)
+		}
+	}
+}
+
+func TestDHCPConfigDnsmasqArgs(t *testing.T) {
+	prefix := netip.MustParsePrefix("192.168.107.1/24")
+	base := []string{
+		"--listen-address=192.168.107.1",
+		"--dhcp-range=192.168.107.2,192.168.107.254,255.255.255.0,192.168.107.255,12h",
+		"--dhcp-option=option:router,192.168.107.1",
+		"--dhcp-option=option:dns-server,192.168.107.1",
+	}
+	tests := []struct {
+		name   string
+		config DHCPConfig
+		want   []string
+	}{
+		{"defaults", DHCPConfig{Prefix: prefix}, base},
+		{"lease time and max leases", DHCPConfig{
+			Prefix:     netip.MustParsePrefix("10.0.0.1/24"),
+			RangeStart: netip.MustParseAddr("10.0.0.10"),
+			RangeEnd:   netip.MustParseAddr("10.0.0.20"),
+			LeaseTime:  150 * time.Second,
+			MaxLeases:  10,
+		}, []string{
+			"--listen-address=10.0.0.1",
+			"--dhcp-range=10.0.0.10,10.0.0.20,255.255.255.0,10.0.0.255,150",
+			"--dhcp-option=option:router,10.0.0.1",
+			"--dhcp-option=option:dns-server,10.0.0.1",
+			"--dhcp-lease-max=10",
+		}},
+		{"dns", DHCPConfig{Prefix: prefix, DNS: &DNSConfig{Domain: "lan"}},
+			append(append([]string{}, base...), "--domain=lan", "--local=/lan/", "--expand-hosts")},
+	}
+	for _, tt := range tests {
+		if got := tt.config.dnsmasqArgs(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDnsmasqDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{12 * time.Hour, "12h"},
+		{45 * time.Minute, "45m"},
+		{150 * time.Minute, "150m"},
+		{90 * time.Second, "90"},
+		{2*time.Hour + 30*time.Second, "7230"},
+	}
+	for _, tt := range tests {
+		if got := dnsmasqDuration(tt.d); got != tt.want {
+			t.Errorf("dnsmasqDuration(%s) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// DNSConfig controls how the dnsmasq of the AP answers the clients' queries.
+// Without it dnsmasq forwards everything to the servers in /etc/resolv.conf.
+type DNSConfig struct {
+	// Domain is the local zone, e.g. "lan". Clients resolve each other by
+	// their DHCP hostname as laptop.lan, queries for the zone are never
+	// forwarded upstream.
+	Domain string
+
+	Hosts  []DNSHost  // optional, A/AAAA records
+	CNAMEs []DNSCNAME // optional, aliases of local names
+
+	// Upstream replaces /etc/resolv.conf as the servers queries are forwarded to
+	Upstream []netip.Addr
+
+	// Forwards send the queries of a domain to its own servers, e.g. a
+	// corporate zone to the VPN's resolver
+	Forwards []DNSForward
+}
+
+// DNSHost is a local name with one or more IPv4 and IPv6 addresses. A name
+// without a dot also resolves inside Domain, "router" as router.lan.
+type DNSHost struct {
+	Name  string
+	Addrs []netip.Addr
+}
+
+// DNSCNAME points Name at Target. dnsmasq only answers it when Target is a
+// local name: a DNSHost, a DHCP hostname or a reservation.
+type DNSCNAME struct {
+	Name   string
+	Target string
+}
+
+// DNSForward sends the queries for Domain and its subdomains to Servers
+type DNSForward struct {
+	Domain  string
+	Servers []netip.Addr
+}
+
+// validate checks the names and addresses of the DNS options
+func (c *DNSConfig) validate(v *ValidationError) {
+	if c.Domain != "" && !validDomain(c.Domain) {
+		v.add("dns.domain", "%q is not a valid domain name", c.Domain)
+	}
+
+	names := map[string]bool{}
+	for i, h := range c.Hosts {
+		field := fmt.Sprintf("dns.hosts[%d]", i)
+		if !validDomain(h.Name) {
+			v.add(field+".name", "%q is not a valid host name", h.Name)
+		} else if names[strings.ToLower(h.Name)] {
+			v.add(field+".name", "%s is defined twice", h.Name)
+		}
+		names[strings.ToLower(h.Name)] = true
+		if len(h.Addrs) == 0 {
+			v.add(field+".addrs", "at least one address is required")
+		}
+		for j, a := range h.Addrs {
+			if !a.IsValid() || a.Zone() != "" {
+				v.add(fmt.Sprintf("%s.addrs[%d]", field, j), "is not a valid address")
+			}
+		}
+	}
+
+	for i, cn := range c.CNAMEs {
+		field := fmt.Sprintf("dns.cnames[%d]", i)
+		if !validDomain(cn.Name) {
+			v.add(field+".name", "%q is not a valid host name", cn.Name)
+		} else if names[strings.ToLower(cn.Name)] {
+			v.add(field+".name", "%s is already a host", cn.Name)
+		}
+		if !validDomain(cn.Target) {
+			v.add(field+".target", "%q is not a valid host name", cn.Target)
+		} else if strings.EqualFold(cn.Name, cn.Target) {
+			v.add(field+".target", "%s points at itself", cn.Target)
+		}
+	}
+
+	for i, a := range c.Upstream {
+		if !a.IsValid() {
+			v.add(fmt.Sprintf("dns.upstream[%d]", i), "is not a valid address")
+		}
+	}
+
+	for i, f := range c.Forwards {
+		field := fmt.Sprintf("dns.forwards[%d]", i)
+		if !validDomain(f.Domain) {
+			v.add(field+".domain", "%q is not a valid domain name", f.Domain)
+		} else if c.Domain != "" && strings.EqualFold(f.Domain, c.Domain) {
+			v.add(field+".domain", "%s is the local domain, it is never forwarded", f.Domain)
+		}
+		if len(f.Servers) == 0 {
+			v.add(field+".servers", "at least one server is required")
+		}
+		for j, a := range f.Servers {
+			if !a.IsValid() {
+				v.add(fmt.Sprintf("%s.servers[%d]", field, j), "is not a valid address")
+			}
+		}
+	}
+}
+
+// dnsmasqArgs returns the dnsmasq options of the DNS config
+func (c *DNSConfig) dnsmasqArgs() []string {
+	var args []string
+	if c.Domain != "" {
+		args = append(args,
+			// Lease and reservation hostnames get the domain, which is also
+			// sent to the clients as their search domain
+			"--domain="+c.Domain,
+			"--local=/"+c.Domain+"/",
+			"--expand-hosts",
+		)
+	}
+
+	for _, h := range c.Hosts {
+		fields := c.names(h.Name)
+		for _, a := range h.Addrs {
+			fields = append(fields, a.String())
+		}
+		args = append(args, "--host-record="+strings.Join(fields, ","))
+	}
+	for _, cn := range c.CNAMEs {
+		fields := append(c.names(cn.Name), c.qualify(cn.Target))
+		args = append(args, "--cname="+strings.Join(fields, ","))
+	}
+
+	if len(c.Upstream) > 0 {
+		args = append(args, "--no-resolv")
+		for _, a := range c.Upstream {
+			args = append(args, "--server="+a.String())
+		}
+	}
+	for _, f := range c.Forwards {
+		for _, a := range f.Servers {
+			args = append(args, "--server=/"+f.Domain+"/"+a.String())
+		}
+	}
+	return args
+}
+
+// names returns name and, when it has no dot, also name inside Domain
+func (c *DNSConfig) names(name string) []string {
+	if q := c.qualify(name); q != name {
+		return []string{name, q}
+	}
+	return []string{name}
+}
+
+// qualify adds Domain to a name without a dot, the form dnsmasq stores
+// local names in
+func (c *DNSConfig) qualify(name string) string {
+	if c.Domain == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return name + "." + c.Domain
+}
+
+// validDomain accepts a DNS name of one or more labels, without a trailing dot
+func validDomain(name string) bool {
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !validLabel(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// validLabel accepts 1-63 letters, digits or hyphens, not starting or ending with a hyphen
+func validLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, r := range label {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
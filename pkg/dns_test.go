@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDNSConfigValidate(t *testing.T) {
+	addrs := []netip.Addr{netip.MustParseAddr("192.168.107.2")}
+	tests := []struct {
+		name   string
+		config DNSConfig
+		fields []string
+	}{
+		{"empty", DNSConfig{}, nil},
+		{"valid", DNSConfig{
+			Domain:   "lan",
+			Hosts:    []DNSHost{{Name: "nas", Addrs: addrs}, {Name: "printer.lan", Addrs: addrs}},
+			CNAMEs:   []DNSCNAME{{Name: "files", Target: "nas"}},
+			Upstream: []netip.Addr{netip.MustParseAddr("1.1.1.1"), netip.MustParseAddr("2606:4700::1111")},
+			Forwards: []DNSForward{{Domain: "corp.example", Servers: []netip.Addr{netip.MustParseAddr("10.8.0.1")}}},
+		}, nil},
+		{"bad domain", DNSConfig{Domain: "-lan"}, []string{"dns.domain"}},
+		{"trailing dot", DNSConfig{Domain: "lan."}, []string{"dns.domain"}},
+		{"bad host name", DNSConfig{Hosts: []DNSHost{{Name: "my_nas", Addrs: addrs}}}, []string{"dns.hosts[0].name"}},
+		{"host twice", DNSConfig{Hosts: []DNSHost{{Name: "nas", Addrs: addrs}, {Name: "NAS", Addrs: addrs}}},
+			[]string{"dns.hosts[1].name"}},
+		{"host without address", DNSConfig{Hosts: []DNSHost{{Name: "nas"}}}, []string{"dns.hosts[0].addrs"}},
+		{"host with zone", DNSConfig{Hosts: []DNSHost{{Name: "nas", Addrs: []netip.Addr{netip.MustParseAddr("fe80::1%wlan0")}}}},
+			[]string{"dns.hosts[0].addrs[0]"}},
+		{"host with invalid address", DNSConfig{Hosts: []DNSHost{{Name: "nas", Addrs: []netip.Addr{{}}}}},
+			[]string{"dns.hosts[0].addrs[0]"}},
+		{"cname is a host", DNSConfig{
+			Hosts:  []DNSHost{{Name: "nas", Addrs: addrs}},
+			CNAMEs: []DNSCNAME{{Name: "nas", Target: "files"}},
+		}, []string{"dns.cnames[0].name"}},
+		{"cname to itself", DNSConfig{CNAMEs: []DNSCNAME{{Name: "files", Target: "FILES"}}}, []string{"dns.cnames[0].target"}},
+		{"bad cname target", DNSConfig{CNAMEs: []DNSCNAME{{Name: "files", Target: ""}}}, []string{"dns.cnames[0].target"}},
+		{"bad upstream", DNSConfig{Upstream: []netip.Addr{{}}}, []string{"dns.upstream[0]"}},
+		{"forward of the local domain", DNSConfig{
+			Domain:   "lan",
+			Forwards: []DNSForward{{Domain: "LAN", Servers: []netip.Addr{netip.MustParseAddr("10.8.0.1")}}},
+		}, []string{"dns.forwards[0].domain"}},
+		{"forward without servers", DNSConfig{Forwards: []DNSForward{{Domain: "corp.example"}}},
+			[]string{"dns.forwards[0].servers"}},
+	}
+	for _, tt := range tests {
+		v := &ValidationError{}
+		tt.config.validate(v)
+		fields := invalidFields(t, v.err())
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: invalid fields %v, want %v", tt.name, fields, tt.fields)
+		}
+	}
+}
+
+func TestDNSConfigDnsmasqArgs(t *testing.T) {
+	addr := netip.MustParseAddr
+	tests := []struct {
+		name   string
+		config DNSConfig
+		want   []string
+	}{
+		{"empty", DNSConfig{}, nil},
+		{"local domain", DNSConfig{
+			Domain: "lan",
+			Hosts: []DNSHost{
+				{Name: "router", Addrs: []netip.Addr{addr("192.168.107.1"), addr("fd00::1")}},
+				{Name: "nas.example.com", Addrs: []netip.Addr{addr("10.0.0.5")}},
+			},
+			CNAMEs:   []DNSCNAME{{Name: "files", Target: "nas"}},
+			Upstream: []netip.Addr{addr("1.1.1.1"), addr("2606:4700::1111")},
+			Forwards: []DNSForward{{Domain: "corp.example", Servers: []netip.Addr{addr("10.8.0.1"), addr("10.8.0.2")}}},
+		}, []string{
+			"--domain=lan",
+			"--local=/lan/",
+			"--expand-hosts",
+			"--host-record=router,router.lan,192.168.107.1,fd00::1",
+			"--host-record=nas.example.com,10.0.0.5",
+			"--cname=files,files.lan,nas.lan",
+			"--no-resolv",
+			"--server=1.1.1.1",
+			"--server=2606:4700::1111",
+			"--server=/corp.example/10.8.0.1",
+			"--server=/corp.example/10.8.0.2",
+		}},
+		{"no domain", DNSConfig{
+			Hosts:  []DNSHost{{Name: "router", Addrs: []netip.Addr{addr("192.168.107.1")}}},
+			CNAMEs: []DNSCNAME{{Name: "gateway", Target: "router"}},
+		}, []string{
+			"--host-record=router,192.168.107.1",
+			"--cname=gateway,router",
+		}},
+	}
+	for _, tt := range tests {
+		if got := tt.config.dnsmasqArgs(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidDomain(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"lan", true},
+		{"home.arpa", true},
+		{"a-b.example", true},
+		{"xn--caf-dma.example", true},
+		{"", false},
+		{"lan.", false},
+		{".lan", false},
+		{"a..b", false},
+		{"-lan", false},
+		{"lan-", false},
+		{"my_host", false},
+		{"café", false},
+		{strings.Repeat("a", 63), true},
+		{strings.Repeat("a", 64), false},
+		{strings.Repeat("a.", 126) + "a", true},
+		{strings.Repeat("a.", 126) + "ab", false},
+	}
+	for _, tt := range tests {
+		if got := validDomain(tt.name); got != tt.want {
+			t.Errorf("validDomain(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
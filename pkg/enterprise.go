@@ -0,0 +1,234 @@
+package pkg
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RadiusServer is an external RADIUS authentication or accounting server
+type RadiusServer struct {
+	Addr   string // IP address of the server
+	Port   int    // optional, 1812 for auth and 1813 for accounting if 0
+	Secret string // shared secret
+}
+
+// EAPUser is one line of hostapd's eap_user file for the integrated EAP server.
+//
+// A typical PEAP/TTLS setup has a phase 1 wildcard user and one phase 2 line
+// per account:
+//
+//	{Identity: "*", Methods: []string{"PEAP", "TTLS"}}
+//	{Identity: "alice", Methods: []string{"MSCHAPV2", "TTLS-MSCHAPV2"}, Password: "secret", Phase2: true}
+type EAPUser struct {
+	Identity string   // user identity, "*" matches any identity
+	Methods  []string // EAP methods, e.g. "PEAP", "TTLS", "MSCHAPV2"
+	Password string   // optional, only for password based methods
+	Phase2   bool     // true for inner (tunneled) authentication
+}
+
+// EnterpriseConfig holds the 802.1X settings for WPA2Enterprise and WPA3Enterprise.
+// Set AuthServers to use an external RADIUS server, or leave it empty and set
+// EAPUsers and the certificates to use hostapd's integrated EAP server.
+type EnterpriseConfig struct {
+	AuthServers   []RadiusServer
+	AcctServers   []RadiusServer // optional
+	NASIdentifier string         // optional, sent to the RADIUS server
+
+	// Integrated EAP server, certificates and key are PEM encoded
+	EAPUsers           []EAPUser
+	CACert             []byte
+	ServerCert         []byte
+	PrivateKey         []byte
+	PrivateKeyPassword string // optional
+}
+
+// usesEAPServer reports whether hostapd's integrated EAP server is used
+func (e *EnterpriseConfig) usesEAPServer() bool {
+	return len(e.AuthServers) == 0
+}
+
+// File names of the integrated EAP server in the runtime directory
+const (
+	eapUserFile   = "hostapd.eap_user"
+	eapCACertFile = "eap_ca.pem"
+	eapCertFile   = "eap_server.pem"
+	eapKeyFile    = "eap_server.key"
+)
+
+// configureEnterprise writes the 802.1X settings into s
+func configureEnterprise(s *HostapdSection, mode SecurityMode, e *EnterpriseConfig) {
+	s.Set("ieee8021x", "1")
+	s.Set("wpa", "2")
+	s.Set("rsn_pairwise", "CCMP")
+
+	if mode == WPA3Enterprise {
+		s.Set("wpa_key_mgmt", "WPA-EAP-SHA256")
+		// PMF is mandatory for WPA3
+		s.Set("ieee80211w", "2")
+	} else {
+		s.Set("wpa_key_mgmt", "WPA-EAP")
+	}
+
+	if e.NASIdentifier != "" {
+		s.Set("nas_identifier", e.NASIdentifier)
+	}
+
+	if e.usesEAPServer() {
+		dir := newRuntimeDir(sectionIfname(s))
+		s.Set("eap_server", "1")
+		s.Set("eap_user_file", dir.file(eapUserFile))
+		s.Set("ca_cert", dir.file(eapCACertFile))
+		s.Set("server_cert", dir.file(eapCertFile))
+		s.Set("private_key", dir.file(eapKeyFile))
+		if e.PrivateKeyPassword != "" {
+			s.Set("private_key_passwd", e.PrivateKeyPassword)
+		}
+		return
+	}
+
+	s.Set("eap_server", "0")
+	// hostapd groups repeated server options in the order they appear
+	for _, srv := range e.AuthServers {
+		port := srv.Port
+		if port == 0 {
+			port = 1812
+		}
+		s.Add("auth_server_addr", srv.Addr)
+		s.Add("auth_server_port", strconv.Itoa(port))
+		s.Add("auth_server_shared_secret", srv.Secret)
+	}
+	for _, srv := range e.AcctServers {
+		port := srv.Port
+		if port == 0 {
+			port = 1813
+		}
+		s.Add("acct_server_addr", srv.Addr)
+		s.Add("acct_server_port", strconv.Itoa(port))
+		s.Add("acct_server_shared_secret", srv.Secret)
+	}
+}
+
+// renderEAPUsers produces the content of hostapd's eap_user file
+func renderEAPUsers(users []EAPUser) string {
+	var sb strings.Builder
+	for _, u := range users {
+		if u.Identity == "*" {
+			sb.WriteString("*")
+		} else {
+			sb.WriteString(`"` + u.Identity + `"`)
+		}
+		sb.WriteString(" ")
+		sb.WriteString(strings.Join(u.Methods, ","))
+		if u.Password != "" {
+			sb.WriteString(` "` + u.Password + `"`)
+		}
+		if u.Phase2 {
+			sb.WriteString(" [2]")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// writeEAPServerFiles writes the eap_user file, certificates and key of the
+// integrated EAP server. They contain secrets, so only root can read them.
+func writeEAPServerFiles(dir runtimeDir, e *EnterpriseConfig) error {
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{eapUserFile, []byte(renderEAPUsers(e.EAPUsers))},
+		{eapCACertFile, e.CACert},
+		{eapCertFile, e.ServerCert},
+		{eapKeyFile, e.PrivateKey},
+	}
+
+	for _, f := range files {
+		if err := dir.writeFile(f.name, f.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateEnterprise checks the RADIUS or EAP server settings
+func validateEnterprise(verr *ValidationError, e *EnterpriseConfig) {
+	if e == nil {
+		verr.add("enterprise", "is required for enterprise security modes")
+		return
+	}
+
+	if hasLineBreak(e.NASIdentifier) {
+		verr.add("enterprise.nas_identifier", "must not contain line breaks")
+	}
+
+	validateRadiusServers(verr, "enterprise.auth_servers", e.AuthServers)
+	validateRadiusServers(verr, "enterprise.acct_servers", e.AcctServers)
+
+	if !e.usesEAPServer() {
+		return
+	}
+
+	if len(e.EAPUsers) == 0 {
+		verr.add("enterprise", "needs either auth_servers or eap_users")
+		return
+	}
+	for i, u := range e.EAPUsers {
+		field := fmt.Sprintf("enterprise.eap_users[%d]", i)
+		if u.Identity == "" {
+			verr.add(field, "identity is required")
+		}
+		if len(u.Methods) == 0 {
+			verr.add(field, "at least one EAP method is required")
+		}
+		if strings.ContainsAny(u.Identity+u.Password, "\"\r\n") {
+			verr.add(field, "identity and password must not contain quotes or line breaks")
+		}
+		for _, m := range u.Methods {
+			if m == "" || strings.ContainsAny(m, ", \t\"\r\n") {
+				verr.add(field, "invalid EAP method %q", m)
+			}
+		}
+	}
+
+	validatePEM(verr, "enterprise.ca_cert", e.CACert)
+	validatePEM(verr, "enterprise.server_cert", e.ServerCert)
+	validatePEM(verr, "enterprise.private_key", e.PrivateKey)
+	if hasLineBreak(e.PrivateKeyPassword) {
+		verr.add("enterprise.private_key_password", "must not contain line breaks")
+	}
+}
+
+func validateRadiusServers(verr *ValidationError, field string, servers []RadiusServer) {
+	for i, srv := range servers {
+		f := fmt.Sprintf("%s[%d]", field, i)
+		if net.ParseIP(srv.Addr) == nil {
+			verr.add(f, "invalid IP address %q", srv.Addr)
+		}
+		if srv.Port < 0 || srv.Port > 65535 {
+			verr.add(f, "invalid port %d", srv.Port)
+		}
+		if srv.Secret == "" {
+			verr.add(f, "shared secret is required")
+		} else if hasLineBreak(srv.Secret) {
+			verr.add(f, "shared secret must not contain line breaks")
+		}
+	}
+}
+
+func validatePEM(verr *ValidationError, field string, data []byte) {
+	if len(data) == 0 {
+		verr.add(field, "is required for the integrated EAP server")
+		return
+	}
+	if block, _ := pem.Decode(data); block == nil {
+		verr.add(field, "is not PEM encoded")
+	}
+}
+
+func hasLineBreak(s string) bool {
+	return strings.ContainsAny(s, "\r\n")
+}
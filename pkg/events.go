@@ -0,0 +1,215 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EventType is the name hostapd gives an event
+type EventType string
+
+const (
+	EventStationConnected    EventType = "AP-STA-CONNECTED"
+	EventStationDisconnected EventType = "AP-STA-DISCONNECTED"
+	EventAPEnabled           EventType = "AP-ENABLED"
+	EventAPDisabled          EventType = "AP-DISABLED"
+	EventPSKMismatch         EventType = "AP-STA-POSSIBLE-PSK-MISMATCH" // wrong WPA/WPA2 passphrase
+	EventEAPFailure          EventType = "CTRL-EVENT-EAP-FAILURE"       // 802.1X authentication failed
+	EventTerminating         EventType = "CTRL-EVENT-TERMINATING"
+
+	EventDFSCACStart     EventType = dfsEventCACStart
+	EventDFSCACCompleted EventType = dfsEventCACCompleted
+	EventDFSRadar        EventType = dfsEventRadar
+	EventDFSNewChannel   EventType = dfsEventNewChannel
+	EventDFSNOPFinished  EventType = dfsEventNOPFinished
+)
+
+// Event is an event reported by hostapd on an attached control socket
+type Event struct {
+	Type   EventType
+	Ifname string           // BSS interface that reported the event
+	MAC    net.HardwareAddr // station events, nil otherwise
+	DFS    *DFSEvent        // DFS events, nil otherwise
+	Raw    string           // the event line without the "<level>" prefix
+	Time   time.Time
+}
+
+// IsAuthFailure reports whether the event is a failed WPA or 802.1X authentication
+func (e Event) IsAuthFailure() bool {
+	return e.Type == EventPSKMismatch || e.Type == EventEAPFailure
+}
+
+const (
+	// eventPingInterval is how often an idle subscription checks hostapd is alive
+	eventPingInterval = 10 * time.Second
+	// eventReattachDelay is the pause before attaching to a restarted hostapd
+	eventReattachDelay = time.Second
+)
+
+// SubscribeHostapdEvents attaches to every BSS control socket of the hostapd
+// started on ifaceName and delivers its events until ctx is canceled, then
+// closes the channel. When hostapd restarts the subscription attaches again.
+func SubscribeHostapdEvents(ctx context.Context, ifaceName string) (<-chan Event, error) {
+	dir := HostapdCtrlDir(ifaceName)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("hostapd control interface not found: %v", err)
+	}
+
+	// The first attach must work so callers see a wrong interface right away
+	var watchers []*eventWatcher
+	for _, e := range entries {
+		w := &eventWatcher{path: filepath.Join(dir, e.Name()), ifname: e.Name()}
+		if err := w.attach(); err != nil {
+			for _, w := range watchers {
+				w.client.Close()
+			}
+			return nil, err
+		}
+		watchers = append(watchers, w)
+	}
+	if len(watchers) == 0 {
+		return nil, fmt.Errorf("no hostapd control socket in %s", dir)
+	}
+
+	events := make(chan Event, 64)
+	done := make(chan struct{})
+	for _, w := range watchers {
+		go func(w *eventWatcher) {
+			w.run(ctx, events)
+			done <- struct{}{}
+		}(w)
+	}
+	go func() {
+		for range watchers {
+			<-done
+		}
+		close(events)
+	}()
+	return events, nil
+}
+
+// eventWatcher follows the events of one control socket
+type eventWatcher struct {
+	path   string
+	ifname string
+	client *HostapdClient
+}
+
+func (w *eventWatcher) attach() error {
+	c, err := DialHostapdSocket(w.path)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Request("ATTACH"); err != nil {
+		c.Close()
+		return err
+	}
+	w.client = c
+	return nil
+}
+
+// run reads events and attaches again whenever the connection is lost
+func (w *eventWatcher) run(ctx context.Context, events chan<- Event) {
+	for {
+		err := w.read(ctx, events)
+		w.client.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("Note: lost hostapd events of %s (%v), attaching again\n", w.ifname, err)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(eventReattachDelay):
+			}
+			if w.attach() == nil {
+				break
+			}
+		}
+	}
+}
+
+// read delivers events until the connection fails, hostapd terminates or ctx is done
+func (w *eventWatcher) read(ctx context.Context, events chan<- Event) error {
+	// Unblock the read when ctx is canceled
+	stop := context.AfterFunc(ctx, func() { w.client.conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	buf := make([]byte, ctrlReplySize)
+	pinged := false
+	for {
+		w.client.conn.SetReadDeadline(time.Now().Add(eventPingInterval))
+		n, err := w.client.conn.Read(buf)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			// Idle: an unanswered PING means hostapd is gone
+			if pinged {
+				return fmt.Errorf("hostapd doesn't answer")
+			}
+			if _, err := w.client.conn.Write([]byte("PING")); err != nil {
+				return err
+			}
+			pinged = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pinged = false
+
+		ev, ok := parseEvent(w.ifname, string(buf[:n]))
+		if !ok {
+			// PONG and other replies
+			continue
+		}
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if ev.Type == EventTerminating {
+			return fmt.Errorf("hostapd terminated")
+		}
+	}
+}
+
+// parseEvent parses an unsolicited message like "<3>AP-STA-CONNECTED aa:bb:cc:dd:ee:ff"
+func parseEvent(ifname, msg string) (Event, bool) {
+	if !strings.HasPrefix(msg, "<") {
+		return Event{}, false
+	}
+	end := strings.IndexByte(msg, '>')
+	if end < 0 {
+		return Event{}, false
+	}
+	line := strings.TrimSpace(msg[end+1:])
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return Event{}, false
+	}
+
+	ev := Event{Type: EventType(fields[0]), Ifname: ifname, Raw: line, Time: time.Now()}
+	switch ev.Type {
+	case EventStationConnected, EventStationDisconnected, EventPSKMismatch, EventEAPFailure:
+		if len(fields) > 1 {
+			ev.MAC, _ = net.ParseMAC(fields[1])
+		}
+	case EventDFSCACStart, EventDFSCACCompleted, EventDFSRadar, EventDFSNewChannel, EventDFSNOPFinished:
+		if dfs, ok := parseDFSEvent(line); ok {
+			ev.DFS = &dfs
+		}
+	}
+	return ev, true
+}
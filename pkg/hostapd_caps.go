@@ -0,0 +1,427 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostapdFeature is an optional feature hostapd is built with
+type HostapdFeature string
+
+const (
+	FeatureHE        HostapdFeature = "802.11ax"   // CONFIG_IEEE80211AX
+	FeatureEHT       HostapdFeature = "802.11be"   // CONFIG_IEEE80211BE
+	FeatureSAE       HostapdFeature = "sae"        // CONFIG_SAE
+	FeatureOWE       HostapdFeature = "owe"        // CONFIG_OWE
+	FeatureEAPServer HostapdFeature = "eap-server" // CONFIG_EAP, integrated EAP server
+	FeatureRADIUS    HostapdFeature = "radius"     // RADIUS client, off with CONFIG_NO_RADIUS
+	FeatureWPS       HostapdFeature = "wps"        // CONFIG_WPS
+	FeatureFT        HostapdFeature = "802.11r"    // CONFIG_IEEE80211R_AP
+	FeatureACS       HostapdFeature = "acs"        // CONFIG_ACS
+)
+
+// hostapdFeatureProbes are config lines hostapd only accepts when built with
+// the feature, without it hostapd reports an error for the line
+var hostapdFeatureProbes = []struct {
+	feature HostapdFeature
+	line    string
+}{
+	{FeatureHE, "ieee80211ax=1"},
+	{FeatureEHT, "ieee80211be=1"},
+	{FeatureSAE, "wpa_key_mgmt=SAE"},
+	{FeatureOWE, "wpa_key_mgmt=OWE"},
+	{FeatureEAPServer, "eap_user_file=/dev/null"},
+	{FeatureRADIUS, "auth_server_addr=127.0.0.1"},
+	{FeatureWPS, "wps_state=0"},
+	{FeatureFT, "mobility_domain=a1b2"},
+	{FeatureACS, "acs_num_scans=5"},
+}
+
+// hostapdProbeIface is the interface of the probe config. It must not exist,
+// so hostapd stops after parsing the config.
+const hostapdProbeIface = "wifigo-probe0"
+
+var hostapdConfigErrorRe = regexp.MustCompile(`Line (\d+): `)
+
+// hostapdBuildOptions names the build option to enable for each feature
+var hostapdBuildOptions = map[HostapdFeature]string{
+	FeatureHE:        "CONFIG_IEEE80211AX=y",
+	FeatureEHT:       "CONFIG_IEEE80211BE=y",
+	FeatureSAE:       "CONFIG_SAE=y",
+	FeatureOWE:       "CONFIG_OWE=y",
+	FeatureEAPServer: "CONFIG_EAP=y",
+	FeatureRADIUS:    "no CONFIG_NO_RADIUS",
+	FeatureWPS:       "CONFIG_WPS=y",
+	FeatureFT:        "CONFIG_IEEE80211R_AP=y",
+	FeatureACS:       "CONFIG_ACS=y",
+}
+
+// HostapdCapabilities describes the installed hostapd binary
+type HostapdCapabilities struct {
+	Path     string
+	Version  string // e.g. "2.10", empty if unknown
+	ModTime  time.Time
+	Features map[HostapdFeature]bool
+}
+
+// Has reports whether hostapd was built with feature
+func (c *HostapdCapabilities) Has(feature HostapdFeature) bool {
+	return c != nil && c.Features[feature]
+}
+
+func (c *HostapdCapabilities) String() string {
+	var features []string
+	for f, ok := range c.Features {
+		if ok {
+			features = append(features, string(f))
+		}
+	}
+	sort.Strings(features)
+	return fmt.Sprintf("hostapd %s (%s): %s", c.Version, c.Path, strings.Join(features, ", "))
+}
+
+var hostapdVersionRe = regexp.MustCompile(`hostapd v(\S+)`)
+
+// hostapdCapsCache holds probe results keyed by binary path, a changed
+// mtime means the binary was replaced and is probed again
+var hostapdCapsCache struct {
+	sync.Mutex
+	byPath map[string]*HostapdCapabilities
+}
+
+// ProbeHostapd determines the version and build features of the hostapd
+// binary in PATH. Results are cached until the binary changes.
+func ProbeHostapd() (*HostapdCapabilities, error) {
+	path, err := exec.LookPath("hostapd")
+	if err != nil {
+		return nil, fmt.Errorf("hostapd not found: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not stat %s: %v", path, err)
+	}
+
+	hostapdCapsCache.Lock()
+	defer hostapdCapsCache.Unlock()
+	if c, ok := hostapdCapsCache.byPath[path]; ok && c.ModTime.Equal(fi.ModTime()) {
+		return c, nil
+	}
+
+	features, err := probeHostapdFeatures(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &HostapdCapabilities{
+		Path:     path,
+		ModTime:  fi.ModTime(),
+		Features: features,
+	}
+
+	// hostapd -v prints the version on stderr and exits with status 1
+	out, _ := exec.Command(path, "-v").CombinedOutput()
+	if m := hostapdVersionRe.FindSubmatch(out); m != nil {
+		c.Version = string(m[1])
+	}
+
+	if hostapdCapsCache.byPath == nil {
+		hostapdCapsCache.byPath = map[string]*HostapdCapabilities{}
+	}
+	hostapdCapsCache.byPath[path] = c
+	return c, nil
+}
+
+// probeHostapdFeatures runs hostapd on a config using every optional feature
+// and reports the features whose config line hostapd rejects as missing
+func probeHostapdFeatures(path string) (map[HostapdFeature]bool, error) {
+	if _, err := net.InterfaceByName(hostapdProbeIface); err == nil {
+		return nil, fmt.Errorf("could not probe %s: interface %s exists", path, hostapdProbeIface)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "interface=%s\ndriver=nl80211\nssid=probe\n", hostapdProbeIface)
+	// hostapd numbers the config lines from 1
+	lineFeatures := map[int]HostapdFeature{}
+	header := strings.Count(sb.String(), "\n")
+	for i, p := range hostapdFeatureProbes {
+		lineFeatures[header+1+i] = p.feature
+		sb.WriteString(p.line + "\n")
+	}
+
+	f, err := os.CreateTemp("", "hostapd-probe-*.conf")
+	if err != nil {
+		return nil, fmt.Errorf("could not create hostapd probe config: %v", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(sb.String())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not write hostapd probe config: %v", err)
+	}
+
+	// hostapd always fails, on the lines of missing features or on the
+	// missing interface, only the config errors matter
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, _ := exec.CommandContext(ctx, path, f.Name()).CombinedOutput()
+	if !bytes.Contains(out, []byte("Configuration file:")) {
+		return nil, fmt.Errorf("could not probe %s: %s", path, strings.TrimSpace(string(out)))
+	}
+
+	features := map[HostapdFeature]bool{}
+	for _, feature := range lineFeatures {
+		features[feature] = true
+	}
+	for _, m := range hostapdConfigErrorRe.FindAllSubmatch(out, -1) {
+		n, _ := strconv.Atoi(string(m[1]))
+		if feature, ok := lineFeatures[n]; ok {
+			features[feature] = false
+		}
+	}
+	return features, nil
+}
+
+// Downgrade is one requested feature replaced by a supported one
+type Downgrade struct {
+	Feature  string // what was requested
+	Fallback string // what is used instead, empty when the AP can't start
+	Reason   string
+}
+
+// DowngradeReport lists every feature StartHostapd had to give up
+type DowngradeReport []Downgrade
+
+func (r DowngradeReport) String() string {
+	var sb strings.Builder
+	for _, d := range r {
+		if d.Fallback == "" {
+			fmt.Fprintf(&sb, "  - %s: %s\n", d.Feature, d.Reason)
+		} else {
+			fmt.Fprintf(&sb, "  - %s -> %s: %s\n", d.Feature, d.Fallback, d.Reason)
+		}
+	}
+	return sb.String()
+}
+
+// warnDowngrades prints the features given up on ifaceName, if any
+func warnDowngrades(caps *HostapdCapabilities, ifaceName string, report DowngradeReport) {
+	if len(report) == 0 {
+		return
+	}
+	fmt.Printf("WARNING: %s or %s can't provide everything requested:\n", caps.Path, ifaceName)
+	fmt.Print(report)
+	fmt.Println("         Install a hostapd built with the listed options or use another adapter to fix this.")
+}
+
+// requirement ties a config feature to what hostapd and the driver need for it
+type requirement struct {
+	feature string                     // requested feature, e.g. "WiFi 7 (802.11be)"
+	applies func(c *WifiConfig) bool   // whether the config uses the feature
+	hostapd HostapdFeature             // build feature hostapd needs, "" if none
+	driver  func(c *WifiConfig) string // why the driver can't, "" if it can (nil = no driver check)
+	// downgrade replaces the feature and returns the fallback, nil when the
+	// feature can't be replaced and the AP must not start
+	downgrade func(c *WifiConfig) string
+}
+
+// requirements are checked in order, so a downgrade is checked again by the
+// requirements of its fallback (WiFi 7 -> 6 -> 5 -> 4)
+func requirements(ifaceName string) []requirement {
+	return []requirement{
+		{
+			feature: "WiFi 7 (802.11be)",
+			applies: func(c *WifiConfig) bool { return c.Standard == Wifi7 },
+			hostapd: FeatureEHT,
+			driver: func(c *WifiConfig) string {
+				if caps := bandCapabilities(c); caps != nil && !caps.EHTSupported {
+					return fmt.Sprintf("%s doesn't support it in AP mode", ifaceName)
+				}
+				return ""
+			},
+			downgrade: func(c *WifiConfig) string {
+				c.Standard = Wifi6
+				if c.Width == 320 {
+					c.Width = 160
+				}
+				return "WiFi 6 (802.11ax)"
+			},
+		},
+		{
+			feature: "WiFi 6 (802.11ax)",
+			// WiFi 6 is also the default standard
+			applies: func(c *WifiConfig) bool { return c.Standard == "" || c.Standard == Wifi6 },
+			hostapd: FeatureHE,
+			driver: func(c *WifiConfig) string {
+				if caps := bandCapabilities(c); caps != nil && !caps.HESupported {
+					return fmt.Sprintf("%s doesn't support it in AP mode", ifaceName)
+				}
+				return ""
+			},
+			downgrade: func(c *WifiConfig) string {
+				// 802.11ac only exists on 5 GHz
+				if resolveBand(c) == "2.4" {
+					return downgradeToWifi4(c)
+				}
+				c.Standard = Wifi5
+				return "WiFi 5 (802.11ac)"
+			},
+		},
+		{
+			feature: "WiFi 5 (802.11ac)",
+			applies: func(c *WifiConfig) bool { return c.Standard == Wifi5 },
+			driver: func(c *WifiConfig) string {
+				if caps := bandCapabilities(c); caps != nil && !caps.VHTSupported {
+					return fmt.Sprintf("%s doesn't support it", ifaceName)
+				}
+				return ""
+			},
+			downgrade: downgradeToWifi4,
+		},
+		{
+			feature: "WPA3 (SAE)",
+			applies: func(c *WifiConfig) bool { return anySecurity(c, SecurityMode.usesSAE) },
+			hostapd: FeatureSAE,
+			driver: func(c *WifiConfig) string {
+				if !checkDriverSAESupport(c.PHY) {
+					return fmt.Sprintf("the driver of %s doesn't support it", ifaceName)
+				}
+				return ""
+			},
+			downgrade: func(c *WifiConfig) string {
+				replaceSecurity(c, SecurityMode.usesSAE, WPA2PSK)
+				return "WPA2-PSK"
+			},
+		},
+		{
+			feature: "OWE (Enhanced Open)",
+			applies: func(c *WifiConfig) bool { return anySecurity(c, SecurityMode.usesOWE) },
+			hostapd: FeatureOWE,
+			driver: func(c *WifiConfig) string {
+				if !checkDriverPMFSupport(c.PHY) {
+					return fmt.Sprintf("the driver of %s doesn't support PMF", ifaceName)
+				}
+				return ""
+			},
+			downgrade: func(c *WifiConfig) string {
+				replaceSecurity(c, SecurityMode.usesOWE, SecurityOpen)
+				return "open network"
+			},
+		},
+		{
+			feature: "802.1X with the integrated EAP server",
+			applies: func(c *WifiConfig) bool {
+				return c.Security.isEnterprise() && c.Enterprise.usesEAPServer()
+			},
+			hostapd: FeatureEAPServer,
+		},
+		{
+			feature: "802.1X with RADIUS",
+			applies: func(c *WifiConfig) bool {
+				if c.Security.isEnterprise() && !c.Enterprise.usesEAPServer() {
+					return true
+				}
+				for _, b := range c.BSS {
+					if b.Security.isEnterprise() {
+						return true
+					}
+				}
+				return false
+			},
+			hostapd: FeatureRADIUS,
+		},
+		{
+			feature: "WPA3-Enterprise",
+			applies: func(c *WifiConfig) bool {
+				return anySecurity(c, func(m SecurityMode) bool { return m == WPA3Enterprise })
+			},
+			driver: func(c *WifiConfig) string {
+				if !checkDriverPMFSupport(c.PHY) {
+					return fmt.Sprintf("the driver of %s doesn't support PMF", ifaceName)
+				}
+				return ""
+			},
+		},
+	}
+}
+
+// downgradeToWifi4 falls back to 802.11n, which allows at most 40 MHz
+func downgradeToWifi4(c *WifiConfig) string {
+	c.Standard = Wifi4
+	if c.Width > 40 {
+		c.Width = 40
+	}
+	return "WiFi 4 (802.11n)"
+}
+
+// anySecurity reports whether the main network or an additional BSS uses a matching mode
+func anySecurity(c *WifiConfig, match func(SecurityMode) bool) bool {
+	if match(c.Security) {
+		return true
+	}
+	for _, b := range c.BSS {
+		if match(b.Security) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceSecurity replaces every matching security mode with mode
+func replaceSecurity(c *WifiConfig, match func(SecurityMode) bool, mode SecurityMode) {
+	if match(c.Security) {
+		c.Security = mode
+	}
+	for i := range c.BSS {
+		if match(c.BSS[i].Security) {
+			c.BSS[i].Security = mode
+		}
+	}
+}
+
+// applyRequirements downgrades every feature of config that hostapd (caps)
+// or the driver of ifaceName doesn't support. It returns what was
+// downgraded and an error listing the features that can't be replaced.
+func applyRequirements(ifaceName string, caps *HostapdCapabilities, config *WifiConfig) (DowngradeReport, error) {
+	var report DowngradeReport
+	var fatal []string
+
+	for _, req := range requirements(ifaceName) {
+		if !req.applies(config) {
+			continue
+		}
+
+		var reason string
+		if req.hostapd != "" && !caps.Has(req.hostapd) {
+			reason = fmt.Sprintf("hostapd was built without it (needs %s)", hostapdBuildOptions[req.hostapd])
+		} else if req.driver != nil {
+			reason = req.driver(config)
+		}
+		if reason == "" {
+			continue
+		}
+
+		d := Downgrade{Feature: req.feature, Reason: reason}
+		if req.downgrade != nil {
+			d.Fallback = req.downgrade(config)
+		} else {
+			fatal = append(fatal, req.feature+": "+reason)
+		}
+		report = append(report, d)
+	}
+
+	if len(fatal) > 0 {
+		return report, fmt.Errorf("unsupported configuration: %s", strings.Join(fatal, "; "))
+	}
+	return report, nil
+}
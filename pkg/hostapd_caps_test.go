@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeHostapd rejects the 802.11be and OWE config lines like a hostapd built
+// without CONFIG_IEEE80211BE and CONFIG_OWE
+const fakeHostapd = `#!/bin/sh
+if [ "$1" = "-v" ]; then
+	echo "hostapd v2.10" >&2
+	exit 1
+fi
+echo "Configuration file: $1"
+grep -n -e '^ieee80211be=' -e '^wpa_key_mgmt=OWE' "$1" | while IFS=: read n line; do
+	echo "Line $n: unknown configuration item '${line%%=*}'"
+done
+echo "2 errors found in configuration file '$1'"
+exit 1
+`
+
+func TestProbeHostapd(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hostapd"), []byte(fakeHostapd), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	caps, err := ProbeHostapd()
+	if err != nil {
+		t.Fatalf("ProbeHostapd: %v", err)
+	}
+	if caps.Version != "2.10" {
+		t.Errorf("Version = %q, want 2.10", caps.Version)
+	}
+	for _, p := range hostapdFeatureProbes {
+		want := p.feature != FeatureEHT && p.feature != FeatureOWE
+		if got := caps.Has(p.feature); got != want {
+			t.Errorf("Has(%s) = %v, want %v", p.feature, got, want)
+		}
+	}
+}
+
+func TestApplyRequirementsDefaultStandard(t *testing.T) {
+	caps := &HostapdCapabilities{Path: "hostapd", Features: map[HostapdFeature]bool{}}
+	config := &WifiConfig{Band: "5", Channel: 36}
+	report, err := applyRequirements("wlan0", caps, config)
+	if err != nil {
+		t.Fatalf("applyRequirements: %v", err)
+	}
+	if len(report) != 1 || report[0].Feature != "WiFi 6 (802.11ax)" {
+		t.Fatalf("report = %+v, want the WiFi 6 downgrade", report)
+	}
+	if config.Standard != Wifi5 {
+		t.Errorf("Standard = %q, want %q", config.Standard, Wifi5)
+	}
+}
@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// HostapdOption is a single key=value line of a hostapd.conf file
+type HostapdOption struct {
+	Key   string
+	Value string
+}
+
+// HostapdSection is an ordered list of options. The first section of a
+// HostapdConfig holds the radio and primary BSS settings, every following
+// section starts with a bss=<ifname> option.
+type HostapdSection struct {
+	Options []HostapdOption
+}
+
+// HostapdConfig is a typed, ordered model of a hostapd.conf file.
+// Build it with NewHostapdConfig or ParseHostapdConfig and write it with Render.
+type HostapdConfig struct {
+	Sections []*HostapdSection
+}
+
+// Get returns the value of the first option with the given key
+func (s *HostapdSection) Get(key string) (string, bool) {
+	for _, opt := range s.Options {
+		if opt.Key == key {
+			return opt.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set replaces the value of an existing key or appends it at the end
+func (s *HostapdSection) Set(key, value string) {
+	for i := range s.Options {
+		if s.Options[i].Key == key {
+			s.Options[i].Value = value
+			return
+		}
+	}
+	s.Options = append(s.Options, HostapdOption{Key: key, Value: value})
+}
+
+// Add appends an option even if the key already exists (hostapd allows
+// repeated keys such as auth_server_addr).
+func (s *HostapdSection) Add(key, value string) {
+	s.Options = append(s.Options, HostapdOption{Key: key, Value: value})
+}
+
+// Delete removes every option with the given key
+func (s *HostapdSection) Delete(key string) {
+	opts := s.Options[:0]
+	for _, opt := range s.Options {
+		if opt.Key != key {
+			opts = append(opts, opt)
+		}
+	}
+	s.Options = opts
+}
+
+// Main returns the first section, creating it if the config is empty
+func (c *HostapdConfig) Main() *HostapdSection {
+	if len(c.Sections) == 0 {
+		c.Sections = append(c.Sections, &HostapdSection{})
+	}
+	return c.Sections[0]
+}
+
+// AddBSS appends a new bss=<ifname> section and returns it
+func (c *HostapdConfig) AddBSS(ifname string) *HostapdSection {
+	c.Main()
+	s := &HostapdSection{Options: []HostapdOption{{Key: "bss", Value: ifname}}}
+	c.Sections = append(c.Sections, s)
+	return s
+}
+
+// Get returns the value of key from the main section
+func (c *HostapdConfig) Get(key string) (string, bool) {
+	return c.Main().Get(key)
+}
+
+// Set sets key in the main section
+func (c *HostapdConfig) Set(key, value string) {
+	c.Main().Set(key, value)
+}
+
+// Render produces the hostapd.conf file content
+func (c *HostapdConfig) Render() string {
+	var sb strings.Builder
+	for i, s := range c.Sections {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		for _, opt := range s.Options {
+			sb.WriteString(opt.Key)
+			sb.WriteString("=")
+			sb.WriteString(opt.Value)
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// Validate makes sure no key or value can break out of its line and inject
+// additional directives into the rendered file.
+func (c *HostapdConfig) Validate() error {
+	for _, s := range c.Sections {
+		for _, opt := range s.Options {
+			if opt.Key == "" || strings.ContainsAny(opt.Key, "=\r\n") {
+				return fmt.Errorf("invalid hostapd option key %q", opt.Key)
+			}
+			if strings.ContainsAny(opt.Value, "\r\n") {
+				return fmt.Errorf("hostapd option %s contains a line break", opt.Key)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseHostapdConfig reads an existing hostapd.conf back into a HostapdConfig.
+// Comments and blank lines are dropped, a bss= line starts a new section.
+func ParseHostapdConfig(r io.Reader) (*HostapdConfig, error) {
+	c := &HostapdConfig{}
+	c.Main()
+
+	current := c.Sections[0]
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: invalid hostapd option %q", lineNo, line)
+		}
+
+		if key == "bss" {
+			current = c.AddBSS(value)
+			continue
+		}
+		current.Add(key, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read hostapd config: %v", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenConfigs are representative configs, rendered into testdata/hostapd/<name>.conf
+var goldenConfigs = []struct {
+	name     string
+	ssid     string
+	password string
+	config   WifiConfig
+}{
+	{"wifi4-2.4ghz-wpa2", "Home", "password123", WifiConfig{
+		Standard: Wifi4, Band: "2.4", Channel: 6, Security: WPA2PSK,
+	}},
+	{"wifi5-5ghz-40mhz-wpa2-wpa3", "Home", "password123", WifiConfig{
+		Standard: Wifi5, Band: "5", Channel: 40, Width: 40, Security: WPA2WPA3, Country: "DE",
+	}},
+	{"wifi6-5ghz-80mhz-owe-hidden", "Cafe", "", WifiConfig{
+		Standard: Wifi6, Band: "5", Channel: 44, Width: 80, Security: OWE, Hidden: true, Isolate: true,
+	}},
+	{"wifi6-6ghz-wpa3", "Home 6E", "password123", WifiConfig{
+		Standard: Wifi6, Band: "6", Channel: 37, Width: 160, Security: WPA3SAE,
+	}},
+	{"wifi7-6ghz-320mhz-wpa3", "Home 7", "password123", WifiConfig{
+		Standard: Wifi7, Band: "6", Channel: 37, Width: 320, Security: WPA3SAE,
+	}},
+	{"wifi6-2.4ghz-multi-bss", "Home", "password123", WifiConfig{
+		Standard: Wifi6, Band: "2.4", Channel: 1, Security: WPA2WPA3,
+		BSS: []BSSConfig{
+			{SSID: "Guest", Security: OWETransition, Isolate: true, MAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}},
+			{SSID: "IoT", Password: "iotpassword", Hidden: true, Ifname: "wlan0_iot", MAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 0x02}},
+		},
+	}},
+}
+
+func TestNewHostapdConfigGolden(t *testing.T) {
+	for _, tt := range goldenConfigs {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			conf, err := NewHostapdConfig("wlan0", tt.ssid, tt.password, &config)
+			if err != nil {
+				t.Fatalf("NewHostapdConfig: %v", err)
+			}
+			got := conf.Render()
+
+			path := filepath.Join("testdata", "hostapd", tt.name+".conf")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("rendered config differs from %s:\n%s", path, got)
+			}
+		})
+	}
+}
+
+func TestHostapdConfigRoundTrip(t *testing.T) {
+	for _, tt := range goldenConfigs {
+		config := tt.config
+		conf, err := NewHostapdConfig("wlan0", tt.ssid, tt.password, &config)
+		if err != nil {
+			t.Fatalf("%s: NewHostapdConfig: %v", tt.name, err)
+		}
+		parsed, err := ParseHostapdConfig(strings.NewReader(conf.Render()))
+		if err != nil {
+			t.Fatalf("%s: ParseHostapdConfig: %v", tt.name, err)
+		}
+		if len(parsed.Sections) != len(conf.Sections) {
+			t.Fatalf("%s: %d sections after parsing, want %d", tt.name, len(parsed.Sections), len(conf.Sections))
+		}
+		if got, want := parsed.Render(), conf.Render(); got != want {
+			t.Errorf("%s: round trip changed the config:\n got %s\nwant %s", tt.name, got, want)
+		}
+	}
+}
+
+func TestParseHostapdConfig(t *testing.T) {
+	in := `# comment
+interface=wlan0
+ssid=with=equals
+
+auth_server_addr=10.0.0.1
+auth_server_addr=10.0.0.2
+bss=wlan0_1
+ssid=Guest
+`
+	conf, err := ParseHostapdConfig(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Sections) != 2 {
+		t.Fatalf("got %d sections, want 2", len(conf.Sections))
+	}
+	if v, _ := conf.Get("ssid"); v != "with=equals" {
+		t.Errorf("ssid = %q, want with=equals", v)
+	}
+	if n := len(conf.Main().Options); n != 4 {
+		t.Errorf("main section has %d options, want 4 (repeated keys kept)", n)
+	}
+	if v, _ := conf.Sections[1].Get("bss"); v != "wlan0_1" {
+		t.Errorf("bss = %q, want wlan0_1", v)
+	}
+
+	if _, err := ParseHostapdConfig(strings.NewReader("no equals sign\n")); err == nil {
+		t.Error("a line without = was accepted")
+	}
+}
+
+func TestHostapdConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		wantErr bool
+	}{
+		{"plain", "ssid", "Home", false},
+		{"newline in value", "ssid", "Home\nwpa=0", true},
+		{"carriage return in value", "ssid", "Home\rwpa=0", true},
+		{"newline in key", "ssid\nwpa", "0", true},
+		{"equals in key", "ssid=x", "Home", true},
+		{"empty key", "", "Home", true},
+	}
+	for _, tt := range tests {
+		conf := &HostapdConfig{}
+		conf.Main().Add(tt.key, tt.value)
+		if err := conf.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 // SetNMManagedState configures whether NetworkManager should manage a specific interface.
@@ -139,6 +140,10 @@ func ResetInterface(ifname string) error {
 	if err := SetInterfaceUp(ifname); err != nil {
 		return fmt.Errorf("failed to bring interface up: %v", err)
 	}
+	// Slow USB adapters take a moment to come back
+	if err := waitInterfaceUp(ifname, 5*time.Second); err != nil {
+		return err
+	}
 
 	fmt.Printf("  Interface %s reset complete\n", ifname)
 	return nil
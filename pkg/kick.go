@@ -0,0 +1,220 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IEEE 802.11 reason codes commonly sent with a deauthentication or disassociation
+const (
+	ReasonUnspecified     = 1 // unspecified reason
+	ReasonPrevAuthInvalid = 2 // previous authentication no longer valid
+	ReasonLeaving         = 3 // the AP is leaving or has left
+	ReasonInactivity      = 4 // disassociated due to inactivity
+	ReasonAPBusy          = 5 // the AP can't handle all associated stations
+)
+
+// StateBaseDir keeps per-interface state that must survive restarts, like
+// the deny list. Unlike RuntimeBaseDir it is not removed on stop.
+var StateBaseDir = "/var/lib/wifigo"
+
+// denyMACFile is the deny list in the state directory, read by hostapd as deny_mac_file
+const denyMACFile = "deny.mac"
+
+// denyListPath returns the deny list of the AP on ifaceName
+func denyListPath(ifaceName string) string {
+	return filepath.Join(StateBaseDir, ifaceName, denyMACFile)
+}
+
+// configureACL makes every BSS accept all stations except the deny list
+func configureACL(conf *HostapdConfig, ifaceName string) {
+	for _, s := range conf.Sections {
+		s.Set("macaddr_acl", "0")
+		s.Set("deny_mac_file", denyListPath(ifaceName))
+	}
+}
+
+// ensureDenyList creates an empty deny list, hostapd fails to start when
+// deny_mac_file doesn't exist
+func ensureDenyList(ifaceName string) error {
+	path := denyListPath(ifaceName)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create state directory: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not create deny list: %v", err)
+	}
+	return f.Close()
+}
+
+// BannedClients returns the MAC addresses in the deny list of ifaceName
+func BannedClients(ifaceName string) ([]net.HardwareAddr, error) {
+	data, err := os.ReadFile(denyListPath(ifaceName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read deny list: %v", err)
+	}
+
+	var macs []net.HardwareAddr
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// hostapd allows a VLAN ID after the address
+		mac, err := net.ParseMAC(strings.Fields(line)[0])
+		if err != nil {
+			continue
+		}
+		macs = append(macs, mac)
+	}
+	return macs, nil
+}
+
+// writeDenyList replaces the deny list of ifaceName
+func writeDenyList(ifaceName string, macs []net.HardwareAddr) error {
+	if err := ensureDenyList(ifaceName); err != nil {
+		return err
+	}
+	var sb strings.Builder
+	sb.WriteString("# Managed by wifigo, one MAC address per line\n")
+	for _, mac := range macs {
+		sb.WriteString(mac.String())
+		sb.WriteString("\n")
+	}
+	path := denyListPath(ifaceName)
+	if err := os.WriteFile(path+".tmp", []byte(sb.String()), 0600); err != nil {
+		return fmt.Errorf("could not write deny list: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("could not write deny list: %v", err)
+	}
+	return nil
+}
+
+// Deauthenticate disconnects a station with an 802.11 reason code. The
+// station may reconnect right away unless it is also denied.
+func (c *HostapdClient) Deauthenticate(mac net.HardwareAddr, reason int) error {
+	_, err := c.Request(fmt.Sprintf("DEAUTHENTICATE %s reason=%d", mac, reason))
+	return err
+}
+
+// Disassociate disconnects a station but keeps its authentication, so it
+// can associate again faster than after a deauthentication
+func (c *HostapdClient) Disassociate(mac net.HardwareAddr, reason int) error {
+	_, err := c.Request(fmt.Sprintf("DISASSOCIATE %s reason=%d", mac, reason))
+	return err
+}
+
+// DenyMAC adds a station to the runtime deny list of the BSS, hostapd
+// disconnects it if it is associated. The change is lost on restart.
+func (c *HostapdClient) DenyMAC(mac net.HardwareAddr) error {
+	_, err := c.Request("DENY_ACL ADD_MAC " + mac.String())
+	return err
+}
+
+// AllowMAC removes a station from the runtime deny list of the BSS
+func (c *HostapdClient) AllowMAC(mac net.HardwareAddr) error {
+	_, err := c.Request("DENY_ACL DEL_MAC " + mac.String())
+	return err
+}
+
+// forEachBSS runs f with a client for every BSS of the hostapd on ifaceName
+func forEachBSS(ifaceName string, f func(c *HostapdClient) error) error {
+	dir := HostapdCtrlDir(ifaceName)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("hostapd is not running on %s: %v", ifaceName, err)
+	}
+	for _, e := range entries {
+		c, err := DialHostapdSocket(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		err = f(c)
+		c.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KickClient disconnects a station from every BSS of the AP on ifaceName.
+// With disassociate the station keeps its authentication.
+func KickClient(ifaceName string, mac net.HardwareAddr, reason int, disassociate bool) error {
+	return forEachBSS(ifaceName, func(c *HostapdClient) error {
+		if disassociate {
+			return c.Disassociate(mac, reason)
+		}
+		return c.Deauthenticate(mac, reason)
+	})
+}
+
+// BanClient adds a station to the deny list, which the AP reads again when
+// it restarts, and disconnects it from the running AP
+func BanClient(ifaceName string, mac net.HardwareAddr, reason int) error {
+	banned, err := BannedClients(ifaceName)
+	if err != nil {
+		return err
+	}
+	if !containsMAC(banned, mac) {
+		if err := writeDenyList(ifaceName, append(banned, mac)); err != nil {
+			return err
+		}
+	}
+
+	// The deny list is only read on start, deny the running AP too
+	if _, err := os.Stat(HostapdCtrlDir(ifaceName)); err != nil {
+		return nil
+	}
+	return forEachBSS(ifaceName, func(c *HostapdClient) error {
+		if err := c.DenyMAC(mac); err != nil {
+			return err
+		}
+		return c.Deauthenticate(mac, reason)
+	})
+}
+
+// UnbanClient removes a station from the deny list. The AP doesn't need to
+// run, the running one is updated when it does.
+func UnbanClient(ifaceName string, mac net.HardwareAddr) error {
+	banned, err := BannedClients(ifaceName)
+	if err != nil {
+		return err
+	}
+	kept := banned[:0]
+	for _, b := range banned {
+		if !bytes.Equal(b, mac) {
+			kept = append(kept, b)
+		}
+	}
+	if err := writeDenyList(ifaceName, kept); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(HostapdCtrlDir(ifaceName)); err != nil {
+		return nil
+	}
+	return forEachBSS(ifaceName, func(c *HostapdClient) error {
+		return c.AllowMAC(mac)
+	})
+}
+
+func containsMAC(macs []net.HardwareAddr, mac net.HardwareAddr) bool {
+	for _, m := range macs {
+		if bytes.Equal(m, mac) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// processLogger returns the first logger that is set, slog.Default() if none is
+func processLogger(loggers ...*slog.Logger) *slog.Logger {
+	for _, l := range loggers {
+		if l != nil {
+			return l
+		}
+	}
+	return slog.Default()
+}
+
+// Attribute keys of the parsed records
+const (
+	logKeySource   = "source"
+	logKeyIfname   = "ifname"
+	logKeyMAC      = "mac"
+	logKeyIP       = "ip"
+	logKeyHostname = "hostname"
+	logKeyReason   = "reason"
+)
+
+// logLine is a parsed output line
+type logLine struct {
+	level slog.Level
+	msg   string
+	attrs []slog.Attr
+}
+
+// processLog turns the output of a process into one log record per line
+type processLog struct {
+	source  string
+	parse   func(line string) logLine
+	logger  *slog.Logger
+	mu      sync.Mutex
+	partial []byte
+}
+
+func newProcessLog(source string, parse func(line string) logLine, logger *slog.Logger) *processLog {
+	return &processLog{source: source, parse: parse, logger: logger}
+}
+
+func (p *processLog) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(p.partial[:i]))
+		p.partial = p.partial[i+1:]
+		if line == "" {
+			continue
+		}
+		l := p.parse(line)
+		attrs := append([]slog.Attr{slog.String(logKeySource, p.source)}, l.attrs...)
+		p.logger.LogAttrs(context.Background(), l.level, l.msg, attrs...)
+	}
+	return len(b), nil
+}
+
+// isFailure reports whether a free-form line reports an error
+func isFailure(line string) bool {
+	line = strings.ToLower(line)
+	for _, word := range []string{"fail", "could not", "couldn't", "unable", "invalid", "error"} {
+		if strings.Contains(line, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostapdModules are the prefixes of hostapd lines that aren't interface names
+var hostapdModules = map[string]bool{
+	"nl80211":    true,
+	"ctrl_iface": true,
+	"ACS":        true,
+	"DFS":        true,
+	"RADIUS":     true,
+	"random":     true,
+}
+
+// parseHostapdLine parses lines like "wlan0: AP-STA-CONNECTED aa:bb:cc:dd:ee:ff",
+// "wlan0: STA aa:bb:cc:dd:ee:ff WPA: pairwise key handshake completed (RSN)"
+// or "nl80211: Could not configure driver mode"
+func parseHostapdLine(line string) logLine {
+	l := logLine{level: slog.LevelInfo, msg: line}
+
+	prefix, rest, ok := strings.Cut(line, ": ")
+	if !ok || strings.ContainsAny(prefix, " =") {
+		if isFailure(line) {
+			l.level = slog.LevelError
+		}
+		return l
+	}
+	if hostapdModules[prefix] {
+		// Driver and module messages are debug output unless something failed
+		l.level = slog.LevelDebug
+		if isFailure(rest) {
+			l.level = slog.LevelError
+		}
+		return l
+	}
+
+	l.msg = rest
+	l.attrs = append(l.attrs, slog.String(logKeyIfname, prefix))
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return l
+	}
+	mac := func(i int) {
+		if len(fields) > i {
+			if hw, err := net.ParseMAC(fields[i]); err == nil {
+				l.attrs = append(l.attrs, slog.String(logKeyMAC, hw.String()))
+			}
+		}
+	}
+
+	switch EventType(fields[0]) {
+	case EventStationConnected:
+		l.msg = "station connected"
+		mac(1)
+	case EventStationDisconnected:
+		l.msg = "station disconnected"
+		mac(1)
+	case EventPSKMismatch:
+		l.level = slog.LevelWarn
+		l.msg = "possible passphrase mismatch"
+		mac(1)
+	case EventEAPFailure:
+		l.level = slog.LevelWarn
+		l.msg = "802.1X authentication failed"
+		mac(1)
+	case EventAPEnabled:
+		l.msg = "AP enabled"
+	case EventAPDisabled:
+		l.level = slog.LevelWarn
+		l.msg = "AP disabled"
+	case EventDFSRadar:
+		l.level = slog.LevelWarn
+	case "STA":
+		// STA <mac> <module>: <text>
+		mac(1)
+		if _, text, ok := strings.Cut(strings.Join(fields[2:], " "), ": "); ok {
+			l.msg = text
+		}
+		switch {
+		case strings.Contains(rest, "pairwise key handshake completed"):
+			l.msg = "WPA handshake completed"
+		case strings.Contains(rest, "4-Way Handshake failed"), strings.Contains(rest, "EAPOL-Key timeout"):
+			l.level = slog.LevelWarn
+			l.msg = "WPA handshake failed"
+		}
+	default:
+		if isFailure(rest) {
+			l.level = slog.LevelError
+		}
+	}
+	return l
+}
+
+// dhcpLine matches the DHCP part of a dnsmasq-dhcp line: "DHCPACK(wlan0) <args>"
+var dhcpLine = regexp.MustCompile(`^(DHCP[A-Z]+)\(([^)]*)\)\s*(.*)$`)
+
+// parseDnsmasqLine parses lines like
+// "dnsmasq-dhcp: DHCPACK(wlan0) 192.168.107.50 aa:bb:cc:dd:ee:ff laptop"
+// or "dnsmasq: failed to create listening socket for 192.168.107.1: Address in use"
+func parseDnsmasqLine(line string) logLine {
+	l := logLine{level: slog.LevelInfo, msg: line}
+
+	prefix, rest, ok := strings.Cut(line, ": ")
+	if !ok {
+		if isFailure(line) {
+			l.level = slog.LevelError
+		}
+		return l
+	}
+	l.msg = rest
+	if prefix != "dnsmasq-dhcp" {
+		switch {
+		case strings.HasPrefix(strings.ToLower(rest), "warning"):
+			l.level = slog.LevelWarn
+		case isFailure(rest):
+			l.level = slog.LevelError
+		}
+		return l
+	}
+
+	// --log-dhcp puts a transaction ID in front
+	if id, after, ok := strings.Cut(rest, " "); ok && strings.Trim(id, "0123456789") == "" {
+		rest = after
+	}
+	m := dhcpLine.FindStringSubmatch(rest)
+	if m == nil {
+		l.msg = rest
+		return l
+	}
+
+	l.msg = m[1]
+	if m[2] != "" {
+		l.attrs = append(l.attrs, slog.String(logKeyIfname, m[2]))
+	}
+	// <ip> <mac> <hostname> or <mac> <reason>, depending on the message
+	args := strings.Fields(m[3])
+	for i, arg := range args {
+		if ip := net.ParseIP(arg); ip != nil {
+			l.attrs = append(l.attrs, slog.String(logKeyIP, ip.String()))
+			continue
+		}
+		hw, err := net.ParseMAC(arg)
+		if err != nil {
+			continue
+		}
+		l.attrs = append(l.attrs, slog.String(logKeyMAC, hw.String()))
+		if tail := args[i+1:]; len(tail) == 1 && m[1] == "DHCPACK" {
+			l.attrs = append(l.attrs, slog.String(logKeyHostname, tail[0]))
+		} else if len(tail) > 0 {
+			l.attrs = append(l.attrs, slog.String(logKeyReason, strings.Join(tail, " ")))
+		}
+		break
+	}
+
+	switch {
+	case m[1] == "DHCPNAK" || m[1] == "DHCPDECLINE":
+		l.level = slog.LevelWarn
+	case strings.Contains(m[3], "no address available"):
+		l.level = slog.LevelWarn
+	}
+	return l
+}
@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// nl80211Conn is a small generic netlink connection to nl80211 for the
+// requests mdlayher/wifi doesn't expose (wiphy capabilities, regulatory rules).
+type nl80211Conn struct {
+	c      *genetlink.Conn
+	family genetlink.Family
+}
+
+func dialNL80211() (*nl80211Conn, error) {
+	c, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not open generic netlink: %v", err)
+	}
+
+	family, err := c.GetFamily(unix.NL80211_GENL_NAME)
+	if err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("nl80211 not available: %v", err)
+	}
+
+	return &nl80211Conn{c: c, family: family}, nil
+}
+
+func (n *nl80211Conn) Close() error {
+	return n.c.Close()
+}
+
+// execute sends cmd with the attributes written by params (may be nil)
+func (n *nl80211Conn) execute(cmd uint8, flags netlink.HeaderFlags, params func(ae *netlink.AttributeEncoder)) ([]genetlink.Message, error) {
+	ae := netlink.NewAttributeEncoder()
+	if params != nil {
+		params(ae)
+	}
+	b, err := ae.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return n.c.Execute(
+		genetlink.Message{
+			Header: genetlink.Header{Command: cmd, Version: n.family.Version},
+			Data:   b,
+		},
+		n.family.ID,
+		netlink.Request|flags,
+	)
+}
+
+// Cipher and AKM suite selectors as advertised by nl80211
+const (
+	cipherSuiteCCMP    uint32 = 0x000fac04
+	cipherSuiteBIPCMAC uint32 = 0x000fac06
+	akmSuiteSAE        uint32 = 0x000fac08
+)
+
+// WiphyInfo holds the capabilities of the physical radio behind an interface
+type WiphyInfo struct {
+	Index        int
+	Name         string
+	CipherSuites []uint32
+	AKMSuites    []uint32 // empty when the driver doesn't advertise them
+	ExtFeatures  []byte   // bitmap indexed by NL80211_EXT_FEATURE_*
+
+	// MaxAPInterfaces is how many AP interfaces (BSSes) can run at the same time
+	MaxAPInterfaces int
+
+	// SelfManagedReg is set when the driver manages its own regulatory domain
+	SelfManagedReg bool
+
+	Bands map[string]*BandCapabilities // keyed by "2.4", "5" and "6"
+}
+
+// HasCipher reports whether the radio supports the given cipher suite selector
+func (w *WiphyInfo) HasCipher(suite uint32) bool {
+	for _, s := range w.CipherSuites {
+		if s == suite {
+			return true
+		}
+	}
+	return false
+}
+
+// HasExtFeature reports whether the NL80211_EXT_FEATURE_* bit is set
+func (w *WiphyInfo) HasExtFeature(feature uint) bool {
+	idx := feature / 8
+	if int(idx) >= len(w.ExtFeatures) {
+		return false
+	}
+	return w.ExtFeatures[idx]&(1<<(feature%8)) != 0
+}
+
+// GetWiphyInfo queries nl80211 for the wiphy that owns ifaceName
+func GetWiphyInfo(ifaceName string) (*WiphyInfo, error) {
+	ifi, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return nil, fmt.Errorf("interface not found %s: %v", ifaceName, err)
+	}
+
+	n, err := dialNL80211()
+	if err != nil {
+		return nil, err
+	}
+	defer n.Close()
+
+	// Split dumps are required to receive the full band and combination data
+	msgs, err := n.execute(unix.NL80211_CMD_GET_WIPHY, netlink.Dump, func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NL80211_ATTR_IFINDEX, uint32(ifi.Index))
+		ae.Flag(unix.NL80211_ATTR_SPLIT_WIPHY_DUMP, true)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get wiphy for %s: %v", ifaceName, err)
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("no wiphy found for %s", ifaceName)
+	}
+
+	info := &WiphyInfo{}
+	for _, m := range msgs {
+		if err := info.parseAttributes(m.Data); err != nil {
+			return nil, fmt.Errorf("could not parse wiphy for %s: %v", ifaceName, err)
+		}
+	}
+	return info, nil
+}
+
+// parseAttributes merges one message of a split wiphy dump into w
+func (w *WiphyInfo) parseAttributes(b []byte) error {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return err
+	}
+
+	for ad.Next() {
+		switch ad.Type() {
+		case unix.NL80211_ATTR_WIPHY:
+			w.Index = int(ad.Uint32())
+		case unix.NL80211_ATTR_WIPHY_NAME:
+			w.Name = ad.String()
+		case unix.NL80211_ATTR_CIPHER_SUITES:
+			w.CipherSuites = decodeUint32List(ad.Bytes())
+		case unix.NL80211_ATTR_AKM_SUITES:
+			w.AKMSuites = decodeUint32List(ad.Bytes())
+		case unix.NL80211_ATTR_EXT_FEATURES:
+			w.ExtFeatures = append([]byte(nil), ad.Bytes()...)
+		case unix.NL80211_ATTR_WIPHY_SELF_MANAGED_REG:
+			w.SelfManagedReg = true
+		case unix.NL80211_ATTR_INTERFACE_COMBINATIONS:
+			ad.Nested(w.parseCombinations)
+		case unix.NL80211_ATTR_WIPHY_BANDS:
+			ad.Nested(w.parseBands)
+		}
+	}
+	return ad.Err()
+}
+
+// decodeUint32List decodes a packed array of native-endian u32 values
+func decodeUint32List(b []byte) []uint32 {
+	out := make([]uint32, 0, len(b)/4)
+	for i := 0; i+4 <= len(b); i += 4 {
+		out = append(out, binary.NativeEndian.Uint32(b[i:i+4]))
+	}
+	return out
+}
@@ -0,0 +1,376 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// BandCapabilities holds what the radio advertises for one band in AP mode
+type BandCapabilities struct {
+	Band string // "2.4", "5" or "6"
+
+	HTSupported bool
+	HTCapa      uint16 // HT Capabilities Info field
+
+	VHTSupported bool
+	VHTCapa      uint32 // VHT Capabilities Info field
+
+	HESupported bool
+	HEPhyCapa   []byte // HE PHY Capabilities Information field for AP mode
+
+	EHTSupported bool
+	EHTPhyCapa   []byte // EHT PHY Capabilities Information field for AP mode
+}
+
+// bandNames maps nl80211 band indexes to the band strings used by WifiConfig
+var bandNames = map[uint16]string{
+	unix.NL80211_BAND_2GHZ: "2.4",
+	unix.NL80211_BAND_5GHZ: "5",
+	unix.NL80211_BAND_6GHZ: "6",
+}
+
+// Band returns the capabilities for band, or nil if the radio doesn't support it
+func (w *WiphyInfo) Band(band string) *BandCapabilities {
+	return w.Bands[band]
+}
+
+// parseBands merges the NL80211_ATTR_WIPHY_BANDS of one split dump message
+func (w *WiphyInfo) parseBands(ad *netlink.AttributeDecoder) error {
+	if w.Bands == nil {
+		w.Bands = map[string]*BandCapabilities{}
+	}
+
+	for ad.Next() {
+		name, ok := bandNames[ad.Type()]
+		if !ok {
+			continue
+		}
+		b, ok := w.Bands[name]
+		if !ok {
+			b = &BandCapabilities{Band: name}
+			w.Bands[name] = b
+		}
+		ad.Nested(b.parseAttributes)
+	}
+	return ad.Err()
+}
+
+func (b *BandCapabilities) parseAttributes(ad *netlink.AttributeDecoder) error {
+	for ad.Next() {
+		switch ad.Type() {
+		case unix.NL80211_BAND_ATTR_HT_CAPA:
+			b.HTSupported = true
+			b.HTCapa = ad.Uint16()
+		case unix.NL80211_BAND_ATTR_VHT_CAPA:
+			b.VHTSupported = true
+			b.VHTCapa = ad.Uint32()
+		case unix.NL80211_BAND_ATTR_IFTYPE_DATA:
+			ad.Nested(b.parseIftypeData)
+		}
+	}
+	return ad.Err()
+}
+
+// parseIftypeData keeps the HE and EHT capabilities that apply to AP interfaces
+func (b *BandCapabilities) parseIftypeData(ad *netlink.AttributeDecoder) error {
+	for ad.Next() {
+		var isAP bool
+		var hePhy, ehtPhy []byte
+		ad.Nested(func(nad *netlink.AttributeDecoder) error {
+			for nad.Next() {
+				switch nad.Type() {
+				case unix.NL80211_BAND_IFTYPE_ATTR_IFTYPES:
+					nad.Nested(func(tad *netlink.AttributeDecoder) error {
+						for tad.Next() {
+							if tad.Type() == unix.NL80211_IFTYPE_AP {
+								isAP = true
+							}
+						}
+						return tad.Err()
+					})
+				case unix.NL80211_BAND_IFTYPE_ATTR_HE_CAP_PHY:
+					hePhy = append([]byte(nil), nad.Bytes()...)
+				case unix.NL80211_BAND_IFTYPE_ATTR_EHT_CAP_PHY:
+					ehtPhy = append([]byte(nil), nad.Bytes()...)
+				}
+			}
+			return nad.Err()
+		})
+		if isAP && len(hePhy) > 0 {
+			b.HESupported = true
+			b.HEPhyCapa = hePhy
+		}
+		if isAP && len(ehtPhy) > 0 {
+			b.EHTSupported = true
+			b.EHTPhyCapa = ehtPhy
+		}
+	}
+	return ad.Err()
+}
+
+// HT Capabilities Info bits (IEEE 802.11-2020 9.4.2.55.2)
+const (
+	htCapLDPC         = 1 << 0
+	htCapHT40         = 1 << 1
+	htCapGreenfield   = 1 << 4
+	htCapSGI20        = 1 << 5
+	htCapSGI40        = 1 << 6
+	htCapTXSTBC       = 1 << 7
+	htCapRXSTBCShift  = 8
+	htCapDelayedBA    = 1 << 10
+	htCapMaxAMSDU     = 1 << 11
+	htCapDSSSCCK40    = 1 << 12
+	htCap40Intolerant = 1 << 14
+	htCapLSIGTXOP     = 1 << 15
+)
+
+// htCapab builds hostapd's ht_capab from what the radio advertises and the
+// channel plan. Without capabilities only the flags every HT radio has are used.
+func htCapab(caps *BandCapabilities, plan *ChannelPlan) (string, error) {
+	var flags []string
+	ht40 := plan.HT40 != ""
+
+	if caps == nil || !caps.HTSupported {
+		if ht40 {
+			flags = append(flags, "[HT40"+plan.HT40+"]")
+		}
+		return strings.Join(append(flags, "[SHORT-GI-20]"), ""), nil
+	}
+
+	c := caps.HTCapa
+	if ht40 {
+		if c&htCapHT40 == 0 {
+			return "", fmt.Errorf("radio doesn't support 40 MHz channels on %s GHz", caps.Band)
+		}
+		flags = append(flags, "[HT40"+plan.HT40+"]")
+	}
+	if c&htCapLDPC != 0 {
+		flags = append(flags, "[LDPC]")
+	}
+	if c&htCapGreenfield != 0 {
+		flags = append(flags, "[GF]")
+	}
+	if c&htCapSGI20 != 0 {
+		flags = append(flags, "[SHORT-GI-20]")
+	}
+	if ht40 && c&htCapSGI40 != 0 {
+		flags = append(flags, "[SHORT-GI-40]")
+	}
+	if c&htCapTXSTBC != 0 {
+		flags = append(flags, "[TX-STBC]")
+	}
+	switch (c >> htCapRXSTBCShift) & 0x3 {
+	case 1:
+		flags = append(flags, "[RX-STBC1]")
+	case 2:
+		flags = append(flags, "[RX-STBC12]")
+	case 3:
+		flags = append(flags, "[RX-STBC123]")
+	}
+	if c&htCapDelayedBA != 0 {
+		flags = append(flags, "[DELAYED-BA]")
+	}
+	if c&htCapMaxAMSDU != 0 {
+		flags = append(flags, "[MAX-AMSDU-7935]")
+	}
+	if ht40 && plan.Band == "2.4" && c&htCapDSSSCCK40 != 0 {
+		flags = append(flags, "[DSSS_CCK-40]")
+	}
+	if c&htCap40Intolerant != 0 {
+		flags = append(flags, "[40-INTOLERANT]")
+	}
+	if c&htCapLSIGTXOP != 0 {
+		flags = append(flags, "[LSIG-TXOP-PROT]")
+	}
+	return strings.Join(flags, ""), nil
+}
+
+// VHT Capabilities Info bits (IEEE 802.11-2020 9.4.2.157.2)
+const (
+	vhtCapMaxMPDUMask      = 0x3
+	vhtCapChWidthShift     = 2
+	vhtCapRXLDPC           = 1 << 4
+	vhtCapSGI80            = 1 << 5
+	vhtCapSGI160           = 1 << 6
+	vhtCapTXSTBC           = 1 << 7
+	vhtCapRXSTBCShift      = 8
+	vhtCapSUBeamformer     = 1 << 11
+	vhtCapSUBeamformee     = 1 << 12
+	vhtCapBFAntennaShift   = 13
+	vhtCapSoundingDimShift = 16
+	vhtCapMUBeamformer     = 1 << 19
+	vhtCapMUBeamformee     = 1 << 20
+	vhtCapTXOPPS           = 1 << 21
+	vhtCapHTCVHT           = 1 << 22
+	vhtCapMaxAMPDUExpShift = 23
+	vhtCapLinkAdaptShift   = 26
+	vhtCapRXAntennaPattern = 1 << 28
+	vhtCapTXAntennaPattern = 1 << 29
+)
+
+// vhtCapab builds hostapd's vht_capab from what the radio advertises and
+// the channel plan. Without capabilities only the width flags are used.
+func vhtCapab(caps *BandCapabilities, plan *ChannelPlan) (string, error) {
+	var flags []string
+
+	if caps == nil {
+		if plan.Width == 160 {
+			flags = append(flags, "[VHT160]")
+		}
+		return strings.Join(flags, ""), nil
+	}
+	if !caps.VHTSupported {
+		return "", fmt.Errorf("radio doesn't support 802.11ac on %s GHz", caps.Band)
+	}
+
+	c := caps.VHTCapa
+	switch c & vhtCapMaxMPDUMask {
+	case 1:
+		flags = append(flags, "[MAX-MPDU-7991]")
+	case 2:
+		flags = append(flags, "[MAX-MPDU-11454]")
+	}
+	if plan.Width == 160 {
+		if (c>>vhtCapChWidthShift)&0x3 == 0 {
+			return "", fmt.Errorf("radio doesn't support 160 MHz channels")
+		}
+		flags = append(flags, "[VHT160]")
+	}
+	if c&vhtCapRXLDPC != 0 {
+		flags = append(flags, "[RXLDPC]")
+	}
+	if c&vhtCapSGI80 != 0 {
+		flags = append(flags, "[SHORT-GI-80]")
+	}
+	if plan.Width == 160 && c&vhtCapSGI160 != 0 {
+		flags = append(flags, "[SHORT-GI-160]")
+	}
+	if c&vhtCapTXSTBC != 0 {
+		flags = append(flags, "[TX-STBC-2BY1]")
+	}
+	switch (c >> vhtCapRXSTBCShift) & 0x7 {
+	case 1:
+		flags = append(flags, "[RX-STBC-1]")
+	case 2:
+		flags = append(flags, "[RX-STBC-12]")
+	case 3:
+		flags = append(flags, "[RX-STBC-123]")
+	case 4:
+		flags = append(flags, "[RX-STBC-1234]")
+	}
+	if c&vhtCapSUBeamformer != 0 {
+		flags = append(flags, "[SU-BEAMFORMER]")
+		if n := (c >> vhtCapSoundingDimShift) & 0x7; n > 0 {
+			flags = append(flags, fmt.Sprintf("[SOUNDING-DIMENSION-%d]", n+1))
+		}
+	}
+	if c&vhtCapSUBeamformee != 0 {
+		flags = append(flags, "[SU-BEAMFORMEE]")
+		if n := (c >> vhtCapBFAntennaShift) & 0x7; n > 0 {
+			flags = append(flags, fmt.Sprintf("[BF-ANTENNA-%d]", n+1))
+		}
+	}
+	if c&vhtCapMUBeamformer != 0 {
+		flags = append(flags, "[MU-BEAMFORMER]")
+	}
+	if c&vhtCapMUBeamformee != 0 {
+		flags = append(flags, "[MU-BEAMFORMEE]")
+	}
+	if c&vhtCapTXOPPS != 0 {
+		flags = append(flags, "[VHT-TXOP-PS]")
+	}
+	if c&vhtCapHTCVHT != 0 {
+		flags = append(flags, "[HTC-VHT]")
+	}
+	flags = append(flags, fmt.Sprintf("[MAX-A-MPDU-LEN-EXP%d]", (c>>vhtCapMaxAMPDUExpShift)&0x7))
+	switch (c >> vhtCapLinkAdaptShift) & 0x3 {
+	case 2:
+		flags = append(flags, "[VHT-LINK-ADAPT2]")
+	case 3:
+		flags = append(flags, "[VHT-LINK-ADAPT3]")
+	}
+	if c&vhtCapRXAntennaPattern != 0 {
+		flags = append(flags, "[RX-ANTENNA-PATTERN]")
+	}
+	if c&vhtCapTXAntennaPattern != 0 {
+		flags = append(flags, "[TX-ANTENNA-PATTERN]")
+	}
+	return strings.Join(flags, ""), nil
+}
+
+// heCapBit reports whether bit (counted from the start of the HE PHY
+// Capabilities Information field) is set
+func heCapBit(phy []byte, bit int) bool {
+	if bit/8 >= len(phy) {
+		return false
+	}
+	return phy[bit/8]&(1<<(bit%8)) != 0
+}
+
+// HE PHY Capabilities Information bits (IEEE 802.11ax-2021 9.4.2.248.3)
+const (
+	hePhyChWidth40In24     = 1
+	hePhyChWidth40And80In5 = 2
+	hePhyChWidth160In5     = 3
+	hePhySUBeamformer      = 31
+	hePhySUBeamformee      = 32
+	hePhyMUBeamformer      = 33
+)
+
+// heBeamforming returns hostapd's he_su_beamformer, he_su_beamformee and
+// he_mu_beamformer values. Without capabilities beamforming stays off.
+func heBeamforming(caps *BandCapabilities) (suBeamformer, suBeamformee, muBeamformer bool) {
+	if caps == nil || !caps.HESupported {
+		return false, false, false
+	}
+	phy := caps.HEPhyCapa
+	return heCapBit(phy, hePhySUBeamformer), heCapBit(phy, hePhySUBeamformee), heCapBit(phy, hePhyMUBeamformer)
+}
+
+// checkHEWidth verifies the radio can use the planned width with HE
+func checkHEWidth(caps *BandCapabilities, plan *ChannelPlan) error {
+	if caps == nil {
+		return nil
+	}
+	if !caps.HESupported {
+		return fmt.Errorf("radio doesn't support 802.11ax on %s GHz in AP mode", caps.Band)
+	}
+	phy := caps.HEPhyCapa
+	switch {
+	case plan.Band == "2.4" && plan.Width == 40 && !heCapBit(phy, hePhyChWidth40In24):
+		return fmt.Errorf("radio doesn't support 40 MHz 802.11ax channels on 2.4 GHz")
+	case plan.Band != "2.4" && plan.Width >= 40 && !heCapBit(phy, hePhyChWidth40And80In5):
+		return fmt.Errorf("radio doesn't support %d MHz 802.11ax channels", plan.Width)
+	// 320 MHz EHT channels run HE at 160 MHz
+	case plan.Band != "2.4" && plan.Width >= 160 && !heCapBit(phy, hePhyChWidth160In5):
+		return fmt.Errorf("radio doesn't support 160 MHz 802.11ax channels")
+	}
+	return nil
+}
+
+// EHT PHY Capabilities Information bits (IEEE 802.11be 9.4.2.313.3)
+const ehtPhy320In6 = 1
+
+// checkEHTWidth verifies the radio can use the planned width with EHT
+func checkEHTWidth(caps *BandCapabilities, plan *ChannelPlan) error {
+	if caps == nil {
+		return nil
+	}
+	if !caps.EHTSupported {
+		return fmt.Errorf("radio doesn't support 802.11be on %s GHz in AP mode", caps.Band)
+	}
+	if plan.Width == 320 && !heCapBit(caps.EHTPhyCapa, ehtPhy320In6) {
+		return fmt.Errorf("radio doesn't support 320 MHz channels")
+	}
+	return nil
+}
+
+func boolToFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
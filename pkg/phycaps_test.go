@@ -0,0 +1,42 @@
+package pkg
+
+import "testing"
+
+func TestCheckHEWidth(t *testing.T) {
+	const (
+		width40In24     = 1 << hePhyChWidth40In24
+		width40And80In5 = 1 << hePhyChWidth40And80In5
+		width160In5     = 1 << hePhyChWidth160In5
+	)
+	tests := []struct {
+		name    string
+		band    string
+		channel int
+		width   int
+		phy     byte
+		wantErr bool
+	}{
+		{"2.4 GHz 20 MHz", "2.4", 6, 20, 0, false},
+		{"2.4 GHz 40 MHz", "2.4", 6, 40, width40In24, false},
+		{"2.4 GHz 40 MHz unsupported", "2.4", 6, 40, 0, true},
+		{"5 GHz 80 MHz", "5", 36, 80, width40And80In5, false},
+		{"5 GHz 80 MHz unsupported", "5", 36, 80, 0, true},
+		{"5 GHz 160 MHz", "5", 36, 160, width40And80In5 | width160In5, false},
+		{"5 GHz 160 MHz unsupported", "5", 36, 160, width40And80In5, true},
+		{"6 GHz 320 MHz", "6", 37, 320, width40And80In5 | width160In5, false},
+		{"6 GHz 320 MHz without HE 160", "6", 37, 320, width40And80In5, true},
+	}
+	for _, tt := range tests {
+		plan, err := PlanChannel(tt.band, tt.channel, tt.width)
+		if err != nil {
+			t.Fatalf("%s: PlanChannel: %v", tt.name, err)
+		}
+		caps := &BandCapabilities{Band: tt.band, HESupported: true, HEPhyCapa: []byte{tt.phy}}
+		if err := checkHEWidth(caps, plan); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkHEWidth() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if err := checkHEWidth(&BandCapabilities{Band: "5"}, &ChannelPlan{Band: "5", Width: 20}); err == nil {
+		t.Error("checkHEWidth() accepted a radio without HE")
+	}
+}
@@ -0,0 +1,135 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// HostapdStartTimeout bounds how long StartHostapd waits for the AP to come
+// up. The channel availability check of a DFS channel is added on top.
+var HostapdStartTimeout = 30 * time.Second
+
+// DnsmasqStartTimeout bounds how long StartDnsmasq waits for its DHCP socket
+var DnsmasqStartTimeout = 10 * time.Second
+
+// readyPollInterval is how often a starting service is checked
+const readyPollInterval = 200 * time.Millisecond
+
+// startupOutputLines is how much output of a failed start is reported
+const startupOutputLines = 20
+
+// waitReady waits until ready is closed or check reports true. When the
+// process exits, ctx is canceled or timeout passes first, the process is
+// stopped and the error carries its last output.
+func waitReady(ctx context.Context, cmd *exec.Cmd, name string, timeout time.Duration, ready <-chan struct{}, check func() bool, output *tailWriter) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	tick := time.NewTicker(readyPollInterval)
+	defer tick.Stop()
+
+	var err error
+	for err == nil {
+		if check != nil && check() {
+			return nil
+		}
+		select {
+		case <-ready:
+			return nil
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-deadline.C:
+			err = fmt.Errorf("%s not ready after %s", name, timeout)
+		case <-tick.C:
+			if processExited(cmd) {
+				err = fmt.Errorf("%s exited during startup: %v", name, cmd.Wait())
+				runCleanup(cmd)
+				return fmt.Errorf("%v%s", err, formatOutput(output.Lines()))
+			}
+		}
+	}
+	StopCmd(cmd)
+	return fmt.Errorf("%v%s", err, formatOutput(output.Lines()))
+}
+
+// processExited reports whether cmd exited, without reaping it so that
+// cmd.Wait still returns its status
+func processExited(cmd *exec.Cmd) bool {
+	var info unix.Siginfo
+	err := unix.Waitid(unix.P_PID, cmd.Process.Pid, &info, unix.WEXITED|unix.WNOHANG|unix.WNOWAIT, nil)
+	return err != nil || info.Signo == int32(unix.SIGCHLD)
+}
+
+// hostapdEnabled reports whether the hostapd on ifaceName beacons, in case
+// the AP-ENABLED line got lost
+func hostapdEnabled(ifaceName string) bool {
+	c, err := DialHostapd(ifaceName)
+	if err != nil {
+		return false
+	}
+	defer c.Close()
+	st, err := c.Status()
+	return err == nil && st.State == "ENABLED"
+}
+
+// udpPortBound reports whether process pid has a UDP socket bound to port
+func udpPortBound(pid, port int) (bool, error) {
+	// Socket inodes of the process from the fd links "socket:[12345]"
+	fdDir := "/proc/" + strconv.Itoa(pid) + "/fd"
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		return false, err
+	}
+	inodes := map[string]bool{}
+	for _, fd := range fds {
+		link, err := os.Readlink(fdDir + "/" + fd.Name())
+		if err == nil && strings.HasPrefix(link, "socket:[") {
+			inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] = true
+		}
+	}
+
+	// /proc/net/udp: "sl local_address rem_address st ... inode", addresses as HEXIP:HEXPORT
+	for _, table := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+		f, err := os.Open(table)
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) < 10 || !inodes[fields[9]] {
+				continue
+			}
+			_, hexPort, ok := strings.Cut(fields[1], ":")
+			if p, err := strconv.ParseUint(hexPort, 16, 16); ok && err == nil && int(p) == port {
+				f.Close()
+				return true, nil
+			}
+		}
+		f.Close()
+	}
+	return false, nil
+}
+
+// waitInterfaceUp waits until the kernel reports ifname up
+func waitInterfaceUp(ifname string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ifi, err := net.InterfaceByName(ifname)
+		if err == nil && ifi.Flags&net.FlagUp != 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("interface %s is not up after %s", ifname, timeout)
+		}
+		time.Sleep(readyPollInterval / 4)
+	}
+}
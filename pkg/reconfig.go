@@ -0,0 +1,493 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ReconfigMethod is how a new WifiConfig is applied to a running hostapd,
+// from the least to the most disruptive
+type ReconfigMethod int
+
+const (
+	ReconfigNone          ReconfigMethod = iota // hostapd keeps running as is
+	ReconfigSet                                 // SET per BSS and RELOAD, stations reconnect
+	ReconfigChannelSwitch                       // CHAN_SWITCH, stations follow the channel switch announcement
+	ReconfigReload                              // hostapd reads its config file again (SIGHUP), the radio restarts
+	ReconfigRestart                             // hostapd is stopped and started again
+)
+
+func (m ReconfigMethod) String() string {
+	switch m {
+	case ReconfigNone:
+		return "none"
+	case ReconfigSet:
+		return "set"
+	case ReconfigChannelSwitch:
+		return "channel switch"
+	case ReconfigReload:
+		return "reload"
+	case ReconfigRestart:
+		return "restart"
+	}
+	return "unknown"
+}
+
+// ReconfigPlan describes how ReconfigureHostapd applies a new config
+type ReconfigPlan struct {
+	Method  ReconfigMethod
+	Reason  string   // why a restart is needed, empty otherwise
+	Changed []string // changed hostapd options as "<ifname>: <key>"
+	TxPower bool     // the transmit power changes, set on the radio directly
+}
+
+func (p *ReconfigPlan) String() string {
+	var sb strings.Builder
+	sb.WriteString(p.Method.String())
+	if p.Reason != "" {
+		sb.WriteString(" (" + p.Reason + ")")
+	}
+	if len(p.Changed) > 0 {
+		sb.WriteString(": " + strings.Join(p.Changed, ", "))
+	}
+	if p.TxPower {
+		sb.WriteString(", tx power")
+	}
+	return sb.String()
+}
+
+// csaBeaconCount is the number of beacons announcing a channel switch
+// before it happens, about half a second
+const csaBeaconCount = 5
+
+// reconfigSetKeys are the BSS options hostapd applies with SET and RELOAD
+var reconfigSetKeys = map[string]bool{
+	"ssid":                  true,
+	"ssid2":                 true,
+	"utf8_ssid":             true,
+	"ignore_broadcast_ssid": true,
+	"ap_isolate":            true,
+	"wpa":                   true,
+	"wpa_passphrase":        true,
+	"wpa_psk":               true,
+	"wpa_key_mgmt":          true,
+	"rsn_pairwise":          true,
+	"ieee80211w":            true,
+	"sae_require_mfp":       true,
+	"sae_pwe":               true,
+}
+
+// reconfigChannelKeys are the radio options a channel switch changes
+var reconfigChannelKeys = map[string]bool{
+	"channel":                      true,
+	"op_class":                     true,
+	"ht_capab":                     true,
+	"vht_capab":                    true,
+	"vht_oper_chwidth":             true,
+	"vht_oper_centr_freq_seg0_idx": true,
+	"he_oper_chwidth":              true,
+	"he_oper_centr_freq_seg0_idx":  true,
+	"eht_oper_chwidth":             true,
+	"eht_oper_centr_freq_seg0_idx": true,
+}
+
+// hostapdInstance is what a hostapd started by StartHostapd runs with
+type hostapdInstance struct {
+	mu          sync.Mutex
+	ifaceName   string
+	addrAndMask string
+	ssid        string
+	password    string
+	config      *WifiConfig
+	conf        *HostapdConfig
+	dir         runtimeDir
+	out         io.Writer
+	logger      *slog.Logger
+}
+
+// hostapdInstances tracks the running hostapd processes
+var hostapdInstances sync.Map // *exec.Cmd -> *hostapdInstance
+
+func lookupInstance(cmd *exec.Cmd) (*hostapdInstance, error) {
+	v, ok := hostapdInstances.Load(cmd)
+	if !ok || cmd.Process == nil {
+		return nil, fmt.Errorf("hostapd is not running")
+	}
+	return v.(*hostapdInstance), nil
+}
+
+// reload rewrites the config file of the running hostapd and makes it read
+// it again (SIGHUP), which restarts the radio with the new settings
+func (inst *hostapdInstance) reload(cmd *exec.Cmd, ssid, password string, config *WifiConfig) error {
+	conf, err := NewHostapdConfig(inst.ifaceName, ssid, password, config)
+	if err != nil {
+		return err
+	}
+	if err := inst.dir.writeFile(hostapdConfFile, []byte(conf.Render())); err != nil {
+		return err
+	}
+	if err := cmd.Process.Signal(syscall.SIGHUP); err != nil {
+		return err
+	}
+	inst.update(ssid, password, config, conf)
+	return nil
+}
+
+// update records the settings hostapd runs with after a change
+func (inst *hostapdInstance) update(ssid, password string, config *WifiConfig, conf *HostapdConfig) {
+	inst.ssid = ssid
+	inst.password = password
+	inst.config = config
+	inst.conf = conf
+}
+
+// PlanHostapdReconfig reports how ReconfigureHostapd would apply config to
+// the hostapd started as cmd, without changing anything. Like StartHostapd
+// it fills in config: channel, radio capabilities and downgrades.
+func PlanHostapdReconfig(cmd *exec.Cmd, ssid, password string, config *WifiConfig) (*ReconfigPlan, error) {
+	inst, err := lookupInstance(cmd)
+	if err != nil {
+		return nil, err
+	}
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	plan, _, err := inst.plan(ssid, password, config)
+	return plan, err
+}
+
+// ReconfigureHostapd applies a new config to the hostapd started as cmd
+// the least disruptive way: SET and RELOAD for BSS settings like the SSID
+// or passphrase, a channel switch announcement for channel and width, a
+// config reload for other radio settings and a restart for anything else.
+// After a restart the returned command replaces cmd, which has exited.
+func ReconfigureHostapd(ctx context.Context, cmd *exec.Cmd, ssid, password string, config *WifiConfig) (*exec.Cmd, *ReconfigPlan, error) {
+	return reconfigureHostapd(ctx, cmd, ssid, password, config, StopCmd)
+}
+
+// reconfigureHostapd is ReconfigureHostapd with stop ending cmd for a
+// restart, a Supervisor must do that itself because it waits for cmd
+func reconfigureHostapd(ctx context.Context, cmd *exec.Cmd, ssid, password string, config *WifiConfig, stop func(*exec.Cmd)) (*exec.Cmd, *ReconfigPlan, error) {
+	inst, err := lookupInstance(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	plan, conf, err := inst.plan(ssid, password, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if caps, err := ProbeHostapd(); err == nil {
+		warnDowngrades(caps, inst.ifaceName, config.Downgrades)
+	}
+
+	if plan.Method == ReconfigRestart {
+		fmt.Printf("Note: restarting hostapd on %s, %s\n", inst.ifaceName, plan.Reason)
+		stop(cmd)
+		newCmd, err := startHostapd(ctx, inst.ifaceName, inst.addrAndMask, ssid, password, config, inst.out, inst.logger)
+		if err != nil {
+			return nil, plan, fmt.Errorf("could not restart hostapd: %v", err)
+		}
+		return newCmd, plan, nil
+	}
+
+	switch plan.Method {
+	case ReconfigSet:
+		err = inst.set(conf)
+	case ReconfigChannelSwitch:
+		err = inst.switchChannel(config)
+	case ReconfigReload:
+		err = inst.dir.writeFile(hostapdConfFile, []byte(conf.Render()))
+		if err == nil {
+			err = cmd.Process.Signal(syscall.SIGHUP)
+		}
+	}
+	if err != nil {
+		return nil, plan, err
+	}
+
+	// Keep the file in sync so a later reload doesn't undo the change
+	if plan.Method == ReconfigSet || plan.Method == ReconfigChannelSwitch {
+		if err := inst.dir.writeFile(hostapdConfFile, []byte(conf.Render())); err != nil {
+			return nil, plan, err
+		}
+	}
+	if plan.TxPower {
+		if err := SetTxPower(inst.ifaceName, config.TxPower); err != nil {
+			fmt.Printf("WARNING: %v, keeping the previous power\n", err)
+		}
+	}
+	inst.update(ssid, password, config, conf)
+	return cmd, plan, nil
+}
+
+// plan prepares config like StartHostapd does and compares the resulting
+// hostapd config with the running one. conf is nil for a restart.
+func (inst *hostapdInstance) plan(ssid, password string, config *WifiConfig) (*ReconfigPlan, *HostapdConfig, error) {
+	if config == nil {
+		return nil, nil, fmt.Errorf("config is required")
+	}
+	old := inst.config
+	plan := &ReconfigPlan{TxPower: config.TxPower != old.TxPower}
+
+	// Carry over what StartHostapd found out about the radio and channel
+	sameCountry := countryCode(config) == countryCode(old)
+	if config.PHY == nil {
+		config.PHY = old.PHY
+	}
+	if config.Regulatory == nil && sameCountry {
+		config.Regulatory = old.Regulatory
+	}
+	if config.Channel == 0 && resolveBand(config) == resolveBand(old) {
+		config.Channel = old.Channel
+	}
+	for i := range config.BSS {
+		if config.BSS[i].MAC == nil && i < len(old.BSS) {
+			config.BSS[i].MAC = old.BSS[i].MAC
+		}
+	}
+	config.DFS = old.DFS
+
+	if err := ValidateWifiConfig(ssid, password, config); err != nil {
+		return nil, nil, err
+	}
+	caps, err := ProbeHostapd()
+	if err != nil {
+		return nil, nil, err
+	}
+	report, err := applyRequirements(inst.ifaceName, caps, config)
+	config.Downgrades = report
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := check6GHz(inst.ifaceName, config); err != nil {
+		return nil, nil, err
+	}
+
+	restart := func(reason string) (*ReconfigPlan, *HostapdConfig, error) {
+		plan.Method = ReconfigRestart
+		plan.Reason = reason
+		config.DFS = nil
+		return plan, nil, nil
+	}
+	switch {
+	case !sameCountry:
+		return restart("the country changes")
+	case config.Channel == 0:
+		return restart("a channel must be selected on the new band")
+	case len(config.BSS) != len(old.BSS):
+		return restart("networks are added or removed")
+	case eapServerChanged(config.Security, config.Enterprise, old.Security, old.Enterprise):
+		return restart("the EAP server settings change")
+	}
+	for i := range config.BSS {
+		b, o := &config.BSS[i], &old.BSS[i]
+		if eapServerChanged(b.Security, b.Enterprise, o.Security, o.Enterprise) {
+			return restart("the EAP server settings change")
+		}
+	}
+
+	// The DFS monitor follows the channel hostapd was started on
+	oldPlan, err := configPlan(old)
+	if err != nil {
+		return nil, nil, err
+	}
+	newPlan, err := configPlan(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if *oldPlan != *newPlan && (isDFSPlan(old.Regulatory, oldPlan, old.Standard) || isDFSPlan(config.Regulatory, newPlan, config.Standard)) {
+		return restart("a DFS channel needs a new channel availability check")
+	}
+
+	conf, err := NewHostapdConfig(inst.ifaceName, ssid, password, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(conf.Sections) != len(inst.conf.Sections) {
+		return restart("networks are added or removed")
+	}
+
+	var set, channel, reload bool
+	for i, s := range conf.Sections {
+		o := inst.conf.Sections[i]
+		ifname := sectionIfname(s)
+		if ifname != sectionIfname(o) {
+			return restart("a network interface changes")
+		}
+		for _, key := range changedKeys(o, s) {
+			plan.Changed = append(plan.Changed, ifname+": "+key)
+			_, present := s.Get(key)
+			switch {
+			case i == 0 && reconfigChannelKeys[key]:
+				channel = true
+			case reconfigSetKeys[key] && present:
+				set = true
+			default:
+				reload = true
+			}
+		}
+	}
+	switch {
+	case reload || (set && channel):
+		plan.Method = ReconfigReload
+	case channel:
+		plan.Method = ReconfigChannelSwitch
+	case set:
+		plan.Method = ReconfigSet
+	}
+	return plan, conf, nil
+}
+
+// eapServerChanged reports whether the files of the integrated EAP server,
+// written only when hostapd starts, change
+func eapServerChanged(mode SecurityMode, e *EnterpriseConfig, oldMode SecurityMode, old *EnterpriseConfig) bool {
+	uses := mode.isEnterprise() && e != nil && e.usesEAPServer()
+	used := oldMode.isEnterprise() && old != nil && old.usesEAPServer()
+	if !uses {
+		return false
+	}
+	return !used || !reflect.DeepEqual(e, old)
+}
+
+// changedKeys returns the keys whose values differ between two sections,
+// repeated keys like auth_server_addr are compared as a whole
+func changedKeys(old, s *HostapdSection) []string {
+	values := func(s *HostapdSection) (map[string][]string, []string) {
+		m := map[string][]string{}
+		var keys []string
+		for _, opt := range s.Options {
+			if _, ok := m[opt.Key]; !ok {
+				keys = append(keys, opt.Key)
+			}
+			m[opt.Key] = append(m[opt.Key], opt.Value)
+		}
+		return m, keys
+	}
+	oldValues, oldKeys := values(old)
+	newValues, newKeys := values(s)
+
+	var changed []string
+	for _, key := range newKeys {
+		if !reflect.DeepEqual(oldValues[key], newValues[key]) {
+			changed = append(changed, key)
+		}
+	}
+	for _, key := range oldKeys {
+		if _, ok := newValues[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
+
+// set applies the changed BSS options with SET on each BSS socket, then
+// makes hostapd apply them with RELOAD
+func (inst *hostapdInstance) set(conf *HostapdConfig) error {
+	ctrlDir := HostapdCtrlDir(inst.ifaceName)
+	for i, s := range conf.Sections {
+		keys := changedKeys(inst.conf.Sections[i], s)
+		if len(keys) == 0 {
+			continue
+		}
+		c, err := DialHostapdSocket(filepath.Join(ctrlDir, sectionIfname(s)))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			value, _ := s.Get(key)
+			if _, err := c.Request("SET " + key + " " + value); err != nil {
+				c.Close()
+				return err
+			}
+		}
+		c.Close()
+	}
+
+	c, err := DialHostapd(inst.ifaceName)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = c.Request("RELOAD")
+	return err
+}
+
+// switchChannel moves the radio with a channel switch announcement, the
+// stations follow without reconnecting
+func (inst *hostapdInstance) switchChannel(config *WifiConfig) error {
+	plan, err := configPlan(config)
+	if err != nil {
+		return err
+	}
+	c, err := DialHostapd(inst.ifaceName)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	_, err = c.Request(chanSwitchCommand(plan, config.Standard))
+	return err
+}
+
+// chanSwitchCommand builds "CHAN_SWITCH <count> <freq> ..." for a channel
+// plan. hostapd takes the standards of the new channel from the flags, so
+// they list every standard configureWifiSettings enables.
+func chanSwitchCommand(plan *ChannelPlan, standard WifiStandard) string {
+	freq := channelToFreq(plan.Band, plan.Channel)
+	offset := secondaryOffset(plan)
+	center := freq + 10*offset
+	switch {
+	case plan.Width == 320:
+		center = channelToFreq(plan.Band, plan.EHTCenterSeg0)
+	case plan.Width >= 40 && plan.CenterSeg0 != 0:
+		center = channelToFreq(plan.Band, plan.CenterSeg0)
+	}
+
+	args := []string{"CHAN_SWITCH", strconv.Itoa(csaBeaconCount), strconv.Itoa(freq)}
+	if offset != 0 {
+		args = append(args, "sec_channel_offset="+strconv.Itoa(offset))
+	}
+	args = append(args,
+		"center_freq1="+strconv.Itoa(center),
+		"bandwidth="+strconv.Itoa(plan.Width))
+
+	ieee80211n, ieee80211ac, ieee80211ax, ieee80211be := enabledStandards(standard, plan.Band)
+	for _, f := range []struct {
+		enabled bool
+		flag    string
+	}{{ieee80211n, "ht"}, {ieee80211ac, "vht"}, {ieee80211ax, "he"}, {ieee80211be, "eht"}} {
+		if f.enabled {
+			args = append(args, f.flag)
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// secondaryOffset returns the sec_channel_offset of a plan: 1 or -1 after
+// the 40 MHz pair holding the primary channel, 0 for 20 MHz. 6 GHz plans
+// have no HT40 direction, their pairs start at channel 1.
+func secondaryOffset(plan *ChannelPlan) int {
+	switch {
+	case plan.HT40 == "+":
+		return 1
+	case plan.HT40 == "-":
+		return -1
+	case plan.Band == "6" && plan.Width >= 40:
+		if start, ok := blockStart(blockStarts6[40], plan.Channel, 40); ok && start != plan.Channel {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+package pkg
+
+import "testing"
+
+func TestChanSwitchCommand(t *testing.T) {
+	tests := []struct {
+		band     string
+		channel  int
+		width    int
+		standard WifiStandard
+		want     string
+	}{
+		{"2.4", 1, 20, Wifi4, "CHAN_SWITCH 5 2412 center_freq1=2412 bandwidth=20 ht"},
+		{"2.4", 1, 40, Wifi6, "CHAN_SWITCH 5 2412 sec_channel_offset=1 center_freq1=2422 bandwidth=40 ht he"},
+		{"2.4", 11, 40, Wifi4, "CHAN_SWITCH 5 2462 sec_channel_offset=-1 center_freq1=2452 bandwidth=40 ht"},
+		{"5", 36, 20, Wifi5, "CHAN_SWITCH 5 5180 center_freq1=5180 bandwidth=20 ht vht"},
+		{"5", 40, 40, Wifi5, "CHAN_SWITCH 5 5200 sec_channel_offset=-1 center_freq1=5190 bandwidth=40 ht vht"},
+		{"5", 44, 80, "", "CHAN_SWITCH 5 5220 sec_channel_offset=1 center_freq1=5210 bandwidth=80 ht vht he"},
+		{"5", 36, 160, Wifi7, "CHAN_SWITCH 5 5180 sec_channel_offset=1 center_freq1=5250 bandwidth=160 ht vht he eht"},
+		{"6", 37, 20, Wifi6, "CHAN_SWITCH 5 6135 center_freq1=6135 bandwidth=20 he"},
+		{"6", 1, 40, Wifi6, "CHAN_SWITCH 5 5955 sec_channel_offset=1 center_freq1=5965 bandwidth=40 he"},
+		{"6", 5, 40, "", "CHAN_SWITCH 5 5975 sec_channel_offset=-1 center_freq1=5965 bandwidth=40 he"},
+		{"6", 37, 80, Wifi6, "CHAN_SWITCH 5 6135 sec_channel_offset=-1 center_freq1=6145 bandwidth=80 he"},
+		{"6", 37, 160, Wifi6, "CHAN_SWITCH 5 6135 sec_channel_offset=-1 center_freq1=6185 bandwidth=160 he"},
+		{"6", 37, 320, Wifi7, "CHAN_SWITCH 5 6135 sec_channel_offset=-1 center_freq1=6105 bandwidth=320 he eht"},
+	}
+	for _, tt := range tests {
+		plan, err := PlanChannel(tt.band, tt.channel, tt.width)
+		if err != nil {
+			t.Fatalf("PlanChannel(%s, %d, %d): %v", tt.band, tt.channel, tt.width, err)
+		}
+		if got := chanSwitchCommand(plan, tt.standard); got != tt.want {
+			t.Errorf("%s GHz channel %d %d MHz %q:\n got %s\nwant %s", tt.band, tt.channel, tt.width, tt.standard, got, tt.want)
+		}
+	}
+}
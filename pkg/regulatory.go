@@ -0,0 +1,260 @@
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// RegRule is one frequency range of a regulatory domain
+type RegRule struct {
+	StartKHz       int
+	EndKHz         int
+	MaxBandwidth   int    // kHz
+	MaxAntennaGain int    // mBi
+	MaxEIRP        int    // mBm (100 * dBm)
+	Flags          uint32 // NL80211_RRF_*
+	CACTime        time.Duration
+}
+
+// RegDomain is the regulatory domain the kernel currently applies
+type RegDomain struct {
+	Country   string // ISO 3166-1 alpha2, "00" is the world domain
+	DFSRegion uint8  // 0 unset, 1 FCC, 2 ETSI, 3 JP
+	Rules     []RegRule
+}
+
+// regDomainTimeout bounds how long SetRegDomain waits for the kernel to apply a country
+const regDomainTimeout = 3 * time.Second
+
+// GetRegDomain reads the regulatory rules that apply to ifaceName. Radios
+// with a self-managed regulatory domain report their own rules.
+func GetRegDomain(ifaceName string) (*RegDomain, error) {
+	wiphy, err := GetWiphyInfo(ifaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := dialNL80211()
+	if err != nil {
+		return nil, err
+	}
+	defer n.Close()
+
+	msgs, err := n.execute(unix.NL80211_CMD_GET_REG, 0, func(ae *netlink.AttributeEncoder) {
+		if wiphy.SelfManagedReg {
+			ae.Uint32(unix.NL80211_ATTR_WIPHY, uint32(wiphy.Index))
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get regulatory domain: %v", err)
+	}
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("no regulatory domain reported")
+	}
+
+	reg := &RegDomain{}
+	if err := reg.parseAttributes(msgs[0].Data); err != nil {
+		return nil, fmt.Errorf("could not parse regulatory domain: %v", err)
+	}
+	return reg, nil
+}
+
+// SetRegDomain asks the kernel to apply country and waits until it reports
+// it. The kernel may refuse or keep a stricter domain, so callers should
+// check the country of the returned domain.
+func SetRegDomain(ifaceName, country string) (*RegDomain, error) {
+	n, err := dialNL80211()
+	if err != nil {
+		return nil, err
+	}
+	_, err = n.execute(unix.NL80211_CMD_REQ_SET_REG, netlink.Acknowledge, func(ae *netlink.AttributeEncoder) {
+		ae.String(unix.NL80211_ATTR_REG_ALPHA2, country)
+	})
+	n.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not set regulatory domain %s: %v", country, err)
+	}
+
+	// The kernel applies the hint asynchronously (crda / regulatory.db)
+	deadline := time.Now().Add(regDomainTimeout)
+	for {
+		reg, err := GetRegDomain(ifaceName)
+		if err != nil {
+			return nil, err
+		}
+		if reg.Country == country || time.Now().After(deadline) {
+			return reg, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (r *RegDomain) parseAttributes(b []byte) error {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return err
+	}
+
+	for ad.Next() {
+		switch ad.Type() {
+		case unix.NL80211_ATTR_REG_ALPHA2:
+			r.Country = ad.String()
+		case unix.NL80211_ATTR_DFS_REGION:
+			r.DFSRegion = ad.Uint8()
+		case unix.NL80211_ATTR_REG_RULES:
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				for nad.Next() {
+					var rule RegRule
+					nad.Nested(rule.parseAttributes)
+					r.Rules = append(r.Rules, rule)
+				}
+				return nad.Err()
+			})
+		}
+	}
+	return ad.Err()
+}
+
+func (rule *RegRule) parseAttributes(ad *netlink.AttributeDecoder) error {
+	for ad.Next() {
+		switch ad.Type() {
+		case unix.NL80211_ATTR_REG_RULE_FLAGS:
+			rule.Flags = ad.Uint32()
+		case unix.NL80211_ATTR_FREQ_RANGE_START:
+			rule.StartKHz = int(ad.Uint32())
+		case unix.NL80211_ATTR_FREQ_RANGE_END:
+			rule.EndKHz = int(ad.Uint32())
+		case unix.NL80211_ATTR_FREQ_RANGE_MAX_BW:
+			rule.MaxBandwidth = int(ad.Uint32())
+		case unix.NL80211_ATTR_POWER_RULE_MAX_ANT_GAIN:
+			rule.MaxAntennaGain = int(ad.Uint32())
+		case unix.NL80211_ATTR_POWER_RULE_MAX_EIRP:
+			rule.MaxEIRP = int(ad.Uint32())
+		case unix.NL80211_ATTR_DFS_CAC_TIME:
+			rule.CACTime = time.Duration(ad.Uint32()) * time.Millisecond
+		}
+	}
+	return ad.Err()
+}
+
+// ruleFor returns the rule covering a 20 MHz channel centered at freq MHz
+func (r *RegDomain) ruleFor(freq int) *RegRule {
+	start, end := (freq-10)*1000, (freq+10)*1000
+	for i := range r.Rules {
+		if r.Rules[i].StartKHz <= start && r.Rules[i].EndKHz >= end {
+			return &r.Rules[i]
+		}
+	}
+	return nil
+}
+
+// CheckChannel validates a channel plan and transmit power (dBm, 0 = driver
+// default) against the regulatory rules. It reports whether the channel
+// needs DFS (radar detection) and returns a clear error for channels the
+// country doesn't allow an AP to use. Like the kernel, txPower is compared
+// with the EIRP limit, the maximum antenna gain of the rule isn't subtracted.
+func (r *RegDomain) CheckChannel(plan *ChannelPlan, standard WifiStandard, txPower int) (dfs bool, err error) {
+	primary := r.ruleFor(channelToFreq(plan.Band, plan.Channel))
+
+	for _, ch := range channelBlock(plan) {
+		freq := channelToFreq(plan.Band, ch)
+		rule := r.ruleFor(freq)
+		switch {
+		case rule == nil:
+			return false, fmt.Errorf("channel %d (%d MHz) is not allowed in country %s", ch, freq, r.Country)
+		case rule.Flags&unix.NL80211_RRF_NO_IR != 0:
+			return false, fmt.Errorf("channel %d (%d MHz) is passive-only (no-IR) in country %s, an AP can't use it", ch, freq, r.Country)
+		case rule.MaxBandwidth < plan.Width*1000 && rule.Flags&unix.NL80211_RRF_AUTO_BW == 0:
+			return false, fmt.Errorf("channel %d allows at most %d MHz in country %s", ch, rule.MaxBandwidth/1000, r.Country)
+		case txPower > 0 && txPower*100 > rule.MaxEIRP:
+			return false, fmt.Errorf("tx power %d dBm exceeds the %d dBm EIRP limit of channel %d in country %s",
+				txPower, rule.MaxEIRP/100, ch, r.Country)
+		}
+		if rule.Flags&unix.NL80211_RRF_DFS != 0 {
+			dfs = true
+		}
+	}
+
+	flags := primary.Flags
+	switch {
+	case plan.HT40 == "+" && flags&unix.NL80211_RRF_NO_HT40PLUS != 0,
+		plan.HT40 == "-" && flags&unix.NL80211_RRF_NO_HT40MINUS != 0:
+		return false, fmt.Errorf("HT40%s is not allowed on channel %d in country %s", plan.HT40, plan.Channel, r.Country)
+	case plan.Width >= 80 && flags&unix.NL80211_RRF_NO_80MHZ != 0:
+		return false, fmt.Errorf("80 MHz channels are not allowed on channel %d in country %s", plan.Channel, r.Country)
+	case plan.Width >= 160 && flags&unix.NL80211_RRF_NO_160MHZ != 0:
+		return false, fmt.Errorf("160 MHz channels are not allowed on channel %d in country %s", plan.Channel, r.Country)
+	case plan.Width == 320 && flags&unix.NL80211_RRF_NO_320MHZ != 0:
+		return false, fmt.Errorf("320 MHz channels are not allowed on channel %d in country %s", plan.Channel, r.Country)
+	case (standard == "" || standard == Wifi6 || standard == Wifi7) && flags&unix.NL80211_RRF_NO_HE != 0:
+		return false, fmt.Errorf("802.11ax is not allowed on channel %d in country %s", plan.Channel, r.Country)
+	case standard == Wifi7 && flags&unix.NL80211_RRF_NO_EHT != 0:
+		return false, fmt.Errorf("802.11be is not allowed on channel %d in country %s", plan.Channel, r.Country)
+	}
+	return dfs, nil
+}
+
+// channels5DFS are the 5 GHz channels that need radar detection in most
+// countries, used when no regulatory rules are available
+var channels5DFS = []int{52, 56, 60, 64, 100, 104, 108, 112, 116, 120, 124, 128, 132, 136, 140, 144}
+
+// isDFSPlan reports whether a plan touches a DFS channel, using the
+// regulatory rules when available
+func isDFSPlan(reg *RegDomain, plan *ChannelPlan, standard WifiStandard) bool {
+	if reg != nil {
+		dfs, err := reg.CheckChannel(plan, standard, 0)
+		if err == nil {
+			return dfs
+		}
+	}
+	if plan.Band != "5" {
+		return false
+	}
+	for _, ch := range channelBlock(plan) {
+		if containsInt(channels5DFS, ch) {
+			return true
+		}
+	}
+	return false
+}
+
+// validCountry reports whether c looks like an ISO 3166-1 alpha2 code or "00"
+func validCountry(c string) bool {
+	if c == "00" {
+		return true
+	}
+	return len(c) == 2 && c[0] >= 'A' && c[0] <= 'Z' && c[1] >= 'A' && c[1] <= 'Z'
+}
+
+// SetTxPower fixes the transmit power of the radio behind ifaceName (dBm),
+// 0 gives the control back to the driver
+func SetTxPower(ifaceName string, dBm int) error {
+	ifi, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return fmt.Errorf("interface not found %s: %v", ifaceName, err)
+	}
+
+	n, err := dialNL80211()
+	if err != nil {
+		return err
+	}
+	defer n.Close()
+
+	_, err = n.execute(unix.NL80211_CMD_SET_WIPHY, netlink.Acknowledge, func(ae *netlink.AttributeEncoder) {
+		ae.Uint32(unix.NL80211_ATTR_IFINDEX, uint32(ifi.Index))
+		if dBm == 0 {
+			ae.Uint32(unix.NL80211_ATTR_WIPHY_TX_POWER_SETTING, unix.NL80211_TX_POWER_AUTOMATIC)
+			return
+		}
+		ae.Uint32(unix.NL80211_ATTR_WIPHY_TX_POWER_SETTING, unix.NL80211_TX_POWER_FIXED)
+		ae.Uint32(unix.NL80211_ATTR_WIPHY_TX_POWER_LEVEL, uint32(dBm*100))
+	})
+	if err != nil {
+		return fmt.Errorf("could not set tx power of %s to %d dBm: %v", ifaceName, dBm, err)
+	}
+	return nil
+}
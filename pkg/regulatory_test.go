@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCheckChannel(t *testing.T) {
+	reg := &RegDomain{Country: "XX", Rules: []RegRule{
+		// 20 dBm EIRP with up to 6 dBi antenna gain, as older regulatory databases list it
+		{StartKHz: 2402000, EndKHz: 2482000, MaxBandwidth: 40000, MaxAntennaGain: 600, MaxEIRP: 2000},
+		{StartKHz: 5170000, EndKHz: 5250000, MaxBandwidth: 80000, MaxEIRP: 2300, Flags: unix.NL80211_RRF_AUTO_BW},
+		{StartKHz: 5250000, EndKHz: 5330000, MaxBandwidth: 80000, MaxEIRP: 2000, Flags: unix.NL80211_RRF_DFS | unix.NL80211_RRF_AUTO_BW},
+		{StartKHz: 5490000, EndKHz: 5710000, MaxBandwidth: 160000, MaxEIRP: 2700, Flags: unix.NL80211_RRF_NO_IR},
+	}}
+	tests := []struct {
+		name    string
+		band    string
+		channel int
+		width   int
+		txPower int
+		dfs     bool
+		wantErr bool
+	}{
+		{"driver default power", "2.4", 6, 20, 0, false, false},
+		{"antenna gain not subtracted", "2.4", 6, 20, 20, false, false},
+		{"above EIRP with antenna gain", "2.4", 6, 20, 21, false, true},
+		{"no antenna gain", "5", 36, 20, 23, false, false},
+		{"above EIRP", "5", 36, 20, 24, false, true},
+		{"dfs channel", "5", 52, 20, 0, true, false},
+		{"80 MHz across rules", "5", 36, 80, 20, false, false},
+		{"80 MHz into dfs", "5", 52, 80, 0, true, false},
+		{"no-IR", "5", 100, 20, 0, false, true},
+		{"not in the domain", "5", 149, 20, 0, false, true},
+	}
+	for _, tt := range tests {
+		plan, err := PlanChannel(tt.band, tt.channel, tt.width)
+		if err != nil {
+			t.Fatalf("%s: PlanChannel: %v", tt.name, err)
+		}
+		dfs, err := reg.CheckChannel(plan, Wifi6, tt.txPower)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: CheckChannel() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && dfs != tt.dfs {
+			t.Errorf("%s: dfs = %v, want %v", tt.name, dfs, tt.dfs)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DHCPReservation always hands the same address to a client
+type DHCPReservation struct {
+	MAC       net.HardwareAddr
+	IP        netip.Addr
+	Hostname  string        // optional, the name the client gets in DNS
+	LeaseTime time.Duration // optional, the pool's lease time if 0
+}
+
+// dnsmasqHostsFile holds the reservations in the runtime directory, dnsmasq
+// reads it again on SIGHUP
+const dnsmasqHostsFile = "dnsmasq.hosts"
+
+// reservationsMu serializes changes of the hosts files and of the
+// Reservations of running DHCP configs
+var reservationsMu sync.Mutex
+
+// dhcpConfigs holds the DHCP config of every dnsmasq started by this process
+var dhcpConfigs sync.Map // iface -> *DHCPConfig
+
+// validateReservations checks that every reservation is a usable address
+// of the pool, with no MAC or address reserved twice
+func (c *DHCPConfig) validateReservations(v *ValidationError) {
+	macs := map[string]bool{}
+	ips := map[netip.Addr]bool{}
+	for i, r := range c.Reservations {
+		field := fmt.Sprintf("dhcp.reservations[%d]", i)
+		if len(r.MAC) != 6 {
+			v.add(field+".mac", "must be a 6 byte MAC address")
+		} else if macs[r.MAC.String()] {
+			v.add(field+".mac", "%s is reserved twice", r.MAC)
+		}
+		macs[r.MAC.String()] = true
+
+		switch {
+		case !r.IP.Is4():
+			v.add(field+".ip", "must be an IPv4 address")
+		case !c.Prefix.Contains(r.IP):
+			v.add(field+".ip", "%s is outside %s", r.IP, c.Prefix.Masked())
+		case r.IP == c.Network() || r.IP == c.Broadcast() || r.IP == c.Gateway():
+			v.add(field+".ip", "%s is the network, broadcast or gateway address", r.IP)
+		case ips[r.IP]:
+			v.add(field+".ip", "%s is reserved twice", r.IP)
+		}
+		ips[r.IP] = true
+
+		if r.Hostname != "" && !validHostname(r.Hostname) {
+			v.add(field+".hostname", "%q must be 1-63 letters, digits or hyphens", r.Hostname)
+		}
+		if r.LeaseTime != 0 && r.LeaseTime < minLeaseTime {
+			v.add(field+".lease_time", "must be at least %s", minLeaseTime)
+		}
+	}
+}
+
+// validHostname accepts a single DNS label that dnsmasq can't mistake for a lease time
+func validHostname(name string) bool {
+	if !validLabel(name) {
+		return false
+	}
+	_, isDuration := parseDnsmasqDuration(name)
+	return !isDuration
+}
+
+// hostsLine renders a reservation as a --dhcp-hostsfile line: mac,ip[,hostname][,lease]
+func (r DHCPReservation) hostsLine() string {
+	fields := []string{r.MAC.String(), r.IP.String()}
+	if r.Hostname != "" {
+		fields = append(fields, r.Hostname)
+	}
+	if r.LeaseTime != 0 {
+		fields = append(fields, dnsmasqDuration(r.LeaseTime))
+	}
+	return strings.Join(fields, ",")
+}
+
+// parseHostsLine parses a line written by hostsLine
+func parseHostsLine(line string) (DHCPReservation, error) {
+	fields := strings.Split(line, ",")
+	if len(fields) < 2 {
+		return DHCPReservation{}, fmt.Errorf("invalid reservation %q", line)
+	}
+	mac, err := net.ParseMAC(fields[0])
+	if err != nil {
+		return DHCPReservation{}, fmt.Errorf("invalid reservation %q: %v", line, err)
+	}
+	ip, err := netip.ParseAddr(fields[1])
+	if err != nil {
+		return DHCPReservation{}, fmt.Errorf("invalid reservation %q: %v", line, err)
+	}
+	r := DHCPReservation{MAC: mac, IP: ip}
+	for _, f := range fields[2:] {
+		if d, ok := parseDnsmasqDuration(f); ok {
+			r.LeaseTime = d
+		} else {
+			r.Hostname = f
+		}
+	}
+	return r, nil
+}
+
+// parseDnsmasqDuration parses a lease time written by dnsmasqDuration
+func parseDnsmasqDuration(s string) (time.Duration, bool) {
+	unit := time.Second
+	switch {
+	case strings.HasSuffix(s, "h"):
+		unit = time.Hour
+	case strings.HasSuffix(s, "m"):
+		unit = time.Minute
+	}
+	if unit != time.Second {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// writeHostsFile replaces the reservations dnsmasq reads
+func writeHostsFile(dir runtimeDir, reservations []DHCPReservation) error {
+	var sb strings.Builder
+	for _, r := range reservations {
+		sb.WriteString(r.hostsLine())
+		sb.WriteString("\n")
+	}
+	return dir.writeFile(dnsmasqHostsFile, []byte(sb.String()))
+}
+
+// DHCPReservations returns the reservations of the dnsmasq running on iface
+func DHCPReservations(iface string) ([]DHCPReservation, error) {
+	data, err := os.ReadFile(newRuntimeDir(iface).file(dnsmasqHostsFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("dnsmasq is not running on %s", iface)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read reservations: %v", err)
+	}
+
+	var reservations []DHCPReservation
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := parseHostsLine(line)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, nil
+}
+
+// AddDHCPReservation reserves an address on the running dnsmasq of iface,
+// replacing an earlier reservation of the same MAC. dnsmasq applies it
+// without a restart, the client gets the address when it renews its lease.
+func AddDHCPReservation(iface string, r DHCPReservation) error {
+	return updateReservations(iface, func(reservations []DHCPReservation) []DHCPReservation {
+		kept := reservations[:0]
+		for _, old := range reservations {
+			if !bytes.Equal(old.MAC, r.MAC) {
+				kept = append(kept, old)
+			}
+		}
+		return append(kept, r)
+	})
+}
+
+// RemoveDHCPReservation drops the reservation of mac on the running dnsmasq of iface
+func RemoveDHCPReservation(iface string, mac net.HardwareAddr) error {
+	return updateReservations(iface, func(reservations []DHCPReservation) []DHCPReservation {
+		kept := reservations[:0]
+		for _, old := range reservations {
+			if !bytes.Equal(old.MAC, mac) {
+				kept = append(kept, old)
+			}
+		}
+		return kept
+	})
+}
+
+// updateReservations changes the hosts file of iface and makes dnsmasq read it
+func updateReservations(iface string, change func([]DHCPReservation) []DHCPReservation) error {
+	reservationsMu.Lock()
+	defer reservationsMu.Unlock()
+
+	dir := newRuntimeDir(iface)
+	pid := dir.runningPID(dnsmasqPIDFile)
+	if pid == 0 {
+		return fmt.Errorf("dnsmasq is not running on %s", iface)
+	}
+	current, err := DHCPReservations(iface)
+	if err != nil {
+		return err
+	}
+
+	pool, err := runningPool(iface)
+	if err != nil {
+		return err
+	}
+	pool.Reservations = change(current)
+	if err := pool.Validate(); err != nil {
+		return err
+	}
+
+	if err := writeHostsFile(dir, pool.Reservations); err != nil {
+		return err
+	}
+	// A restart after a crash keeps the change
+	if c, ok := dhcpConfigs.Load(iface); ok {
+		c.(*DHCPConfig).Reservations = pool.Reservations
+	}
+	if err := syscall.Kill(pid, syscall.SIGHUP); err != nil {
+		return fmt.Errorf("could not reload dnsmasq: %v", err)
+	}
+	return nil
+}
+
+// runningPool returns a copy of the DHCP config of the dnsmasq on iface.
+// When another process started it, the pool is derived from the address
+// of the interface.
+func runningPool(iface string) (*DHCPConfig, error) {
+	if c, ok := dhcpConfigs.Load(iface); ok {
+		pool := *c.(*DHCPConfig)
+		return &pool, nil
+	}
+
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("interface not found %s: %v", iface, err)
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("could not read addresses of %s: %v", iface, err)
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.To4() == nil {
+			continue
+		}
+		addr, _ := netip.AddrFromSlice(ipnet.IP.To4())
+		ones, _ := ipnet.Mask.Size()
+		return &DHCPConfig{Prefix: netip.PrefixFrom(addr, ones)}, nil
+	}
+	return nil, fmt.Errorf("%s has no IPv4 address", iface)
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHostsLine(t *testing.T) {
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ip := netip.MustParseAddr("192.168.107.10")
+	tests := []struct {
+		line    string
+		want    DHCPReservation
+		wantErr bool
+	}{
+		{line: "aa:bb:cc:dd:ee:ff,192.168.107.10", want: DHCPReservation{MAC: mac, IP: ip}},
+		{line: "aa:bb:cc:dd:ee:ff,192.168.107.10,laptop", want: DHCPReservation{MAC: mac, IP: ip, Hostname: "laptop"}},
+		{line: "aa:bb:cc:dd:ee:ff,192.168.107.10,30m", want: DHCPReservation{MAC: mac, IP: ip, LeaseTime: 30 * time.Minute}},
+		{line: "aa:bb:cc:dd:ee:ff,192.168.107.10,laptop,1h", want: DHCPReservation{MAC: mac, IP: ip, Hostname: "laptop", LeaseTime: time.Hour}},
+		{line: "AA-BB-CC-DD-EE-FF,192.168.107.10,600", want: DHCPReservation{MAC: mac, IP: ip, LeaseTime: 10 * time.Minute}},
+		{line: "aa:bb:cc:dd:ee:ff", wantErr: true},
+		{line: "aa:bb:cc,192.168.107.10", wantErr: true},
+		{line: "aa:bb:cc:dd:ee:ff,laptop", wantErr: true},
+		{line: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseHostsLine(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseHostsLine(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHostsLine(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHostsLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestHostsLineRoundTrip(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+	ip := netip.MustParseAddr("10.0.0.5")
+	for _, r := range []DHCPReservation{
+		{MAC: mac, IP: ip},
+		{MAC: mac, IP: ip, Hostname: "printer"},
+		{MAC: mac, IP: ip, LeaseTime: 45 * time.Minute},
+		{MAC: mac, IP: ip, Hostname: "printer", LeaseTime: 90 * time.Second},
+	} {
+		line := r.hostsLine()
+		got, err := parseHostsLine(line)
+		if err != nil {
+			t.Errorf("parseHostsLine(%q): %v", line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, r) {
+			t.Errorf("%q parsed as %+v, want %+v", line, got, r)
+		}
+	}
+}
+
+func TestParseDnsmasqDuration(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{"12h", 12 * time.Hour, true},
+		{"45m", 45 * time.Minute, true},
+		{"90", 90 * time.Second, true},
+		{"0", 0, true},
+		{"-5m", 0, false},
+		{"h", 0, false},
+		{"1d", 0, false},
+		{"laptop", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDnsmasqDuration(tt.s)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseDnsmasqDuration(%q) = %s, %v, want %s, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValidateReservations(t *testing.T) {
+	mac1 := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+	mac2 := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x02}
+	addr := netip.MustParseAddr
+	tests := []struct {
+		name         string
+		reservations []DHCPReservation
+		fields       []string
+	}{
+		{"valid", []DHCPReservation{
+			{MAC: mac1, IP: addr("192.168.107.10"), Hostname: "laptop", LeaseTime: time.Hour},
+			{MAC: mac2, IP: addr("192.168.107.11")},
+		}, nil},
+		{"short mac", []DHCPReservation{{MAC: mac1[:4], IP: addr("192.168.107.10")}},
+			[]string{"dhcp.reservations[0].mac"}},
+		{"mac twice", []DHCPReservation{{MAC: mac1, IP: addr("192.168.107.10")}, {MAC: mac1, IP: addr("192.168.107.11")}},
+			[]string{"dhcp.reservations[1].mac"}},
+		{"ip twice", []DHCPReservation{{MAC: mac1, IP: addr("192.168.107.10")}, {MAC: mac2, IP: addr("192.168.107.10")}},
+			[]string{"dhcp.reservations[1].ip"}},
+		{"outside the subnet", []DHCPReservation{{MAC: mac1, IP: addr("10.0.0.1")}},
+			[]string{"dhcp.reservations[0].ip"}},
+		{"gateway", []DHCPReservation{{MAC: mac1, IP: addr("192.168.107.1")}},
+			[]string{"dhcp.reservations[0].ip"}},
+		{"ipv6", []DHCPReservation{{MAC: mac1, IP: addr("fd00::10")}},
+			[]string{"dhcp.reservations[0].ip"}},
+		{"hostname like a lease time", []DHCPReservation{{MAC: mac1, IP: addr("192.168.107.10"), Hostname: "10m"}},
+			[]string{"dhcp.reservations[0].hostname"}},
+		{"hostname with a dot", []DHCPReservation{{MAC: mac1, IP: addr("192.168.107.10"), Hostname: "laptop.lan"}},
+			[]string{"dhcp.reservations[0].hostname"}},
+		{"short lease", []DHCPReservation{{MAC: mac1, IP: addr("192.168.107.10"), LeaseTime: time.Minute}},
+			[]string{"dhcp.reservations[0].lease_time"}},
+	}
+	for _, tt := range tests {
+		c := &DHCPConfig{Prefix: netip.MustParsePrefix("192.168.107.1/24"), Reservations: tt.reservations}
+		fields := invalidFields(t, c.Validate())
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: invalid fields %v, want %v", tt.name, fields, tt.fields)
+		}
+	}
+}
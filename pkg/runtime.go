@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// RuntimeBaseDir holds one runtime directory per interface with the
+// generated configs, control sockets, lease and PID files of its instance.
+var RuntimeBaseDir = "/run/wifigo"
+
+// runtimeDir is the runtime directory of the instance running on one interface
+type runtimeDir string
+
+// newRuntimeDir returns the runtime directory of ifaceName without creating it
+func newRuntimeDir(ifaceName string) runtimeDir {
+	return runtimeDir(filepath.Join(RuntimeBaseDir, ifaceName))
+}
+
+// file returns the path of name inside the directory
+func (d runtimeDir) file(name string) string {
+	return filepath.Join(string(d), name)
+}
+
+// create makes the directory, readable by root only. An existing directory
+// is reused but must be a real directory, not a symlink planted elsewhere.
+func (d runtimeDir) create() error {
+	if err := os.MkdirAll(RuntimeBaseDir, 0755); err != nil {
+		return fmt.Errorf("could not create runtime directory %s: %v", RuntimeBaseDir, err)
+	}
+	if err := os.Mkdir(string(d), 0700); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("could not create runtime directory %s: %v", d, err)
+	}
+	fi, err := os.Lstat(string(d))
+	if err != nil {
+		return fmt.Errorf("could not create runtime directory %s: %v", d, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("runtime directory %s is not a directory", d)
+	}
+	// Mkdir honours the umask and an existing directory keeps its mode
+	if err := os.Chmod(string(d), 0700); err != nil {
+		return fmt.Errorf("could not protect runtime directory %s: %v", d, err)
+	}
+	return nil
+}
+
+// writeFile writes name with 0600 permissions, replacing any previous file
+func (d runtimeDir) writeFile(name string, data []byte) error {
+	path := d.file(name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("could not write %s: %v", path, err)
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(tmp, 0600); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not protect %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not write %s: %v", path, err)
+	}
+	return nil
+}
+
+// checkPID fails when the process recorded in the PID file name still runs,
+// so two instances never share the same files. A stale file is removed.
+func (d runtimeDir) checkPID(name string) error {
+	if pid := d.runningPID(name); pid != 0 {
+		return fmt.Errorf("another instance is already running on %s (pid %d)", filepath.Base(string(d)), pid)
+	}
+	os.Remove(d.file(name))
+	return nil
+}
+
+// runningPID returns the process recorded in the PID file name, 0 when it
+// doesn't run
+func (d runtimeDir) runningPID(name string) int {
+	data, err := os.ReadFile(d.file(name))
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 || syscall.Kill(pid, 0) != nil {
+		return 0
+	}
+	return pid
+}
+
+// writePID records the PID of a started process
+func (d runtimeDir) writePID(name string, cmd *exec.Cmd) error {
+	return d.writeFile(name, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"))
+}
+
+// remove deletes the given files and the directory once it is empty
+func (d runtimeDir) remove(names ...string) {
+	for _, name := range names {
+		os.RemoveAll(d.file(name))
+	}
+	// Fails while another process of the instance still has files here
+	os.Remove(string(d))
+}
+
+// cleanups holds the runtime files to remove when a process is stopped
+var cleanups sync.Map // *exec.Cmd -> func()
+
+// onStop registers a cleanup that StopCmd runs after cmd exited
+func onStop(cmd *exec.Cmd, cleanup func()) {
+	cleanups.Store(cmd, cleanup)
+}
+
+// runCleanup runs the cleanup registered for cmd, once
+func runCleanup(cmd *exec.Cmd) {
+	if cleanup, ok := cleanups.LoadAndDelete(cmd); ok {
+		cleanup.(func())()
+	}
+}
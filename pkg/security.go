@@ -0,0 +1,239 @@
+package pkg
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/sys/unix"
+)
+
+// SecurityMode selects the authentication used by the access point
+type SecurityMode string
+
+const (
+	WPA2PSK  SecurityMode = "wpa2-psk"  // WPA2-Personal (default)
+	WPA3SAE  SecurityMode = "wpa3-sae"  // WPA3-Personal, PMF required
+	WPA2WPA3 SecurityMode = "wpa2-wpa3" // WPA2/WPA3 transition mode, PMF optional
+
+	SecurityOpen  SecurityMode = "open"           // no encryption, no password
+	OWE           SecurityMode = "owe"            // Enhanced Open: encrypted, no password
+	OWETransition SecurityMode = "owe-transition" // open BSS + hidden OWE BSS for legacy clients
+
+	WPA2Enterprise SecurityMode = "wpa2-enterprise" // 802.1X with WPA-EAP, see EnterpriseConfig
+	WPA3Enterprise SecurityMode = "wpa3-enterprise" // 802.1X with WPA-EAP-SHA256, PMF required
+)
+
+// saeAntiCloggingThreshold is the number of pending SAE commits before hostapd
+// starts asking for anti-clogging tokens.
+const saeAntiCloggingThreshold = "5"
+
+// usesSAE reports whether the mode needs SAE support from hostapd and the driver
+func (m SecurityMode) usesSAE() bool {
+	return m == WPA3SAE || m == WPA2WPA3
+}
+
+// usesOWE reports whether the mode needs OWE support from hostapd
+func (m SecurityMode) usesOWE() bool {
+	return m == OWE || m == OWETransition
+}
+
+// isEnterprise reports whether the mode authenticates with 802.1X
+func (m SecurityMode) isEnterprise() bool {
+	return m == WPA2Enterprise || m == WPA3Enterprise
+}
+
+// allowedOn6GHz reports whether the mode may be used on the 6 GHz band,
+// which only allows WPA3 and OWE
+func (m SecurityMode) allowedOn6GHz() bool {
+	return m == WPA3SAE || m == OWE || m == WPA3Enterprise
+}
+
+// isOpen reports whether the mode works without a password
+func (m SecurityMode) isOpen() bool {
+	return m == SecurityOpen || m.usesOWE()
+}
+
+// configureSecurity writes the authentication settings of one BSS into its
+// section s of conf. OWE transition mode also adds the hidden OWE BSS.
+func configureSecurity(conf *HostapdConfig, s *HostapdSection, ssid, password string, mode SecurityMode, enterprise *EnterpriseConfig, band string) {
+	switch mode {
+	case WPA2Enterprise, WPA3Enterprise:
+		configureEnterprise(s, mode, enterprise)
+		return
+	case SecurityOpen:
+		s.Set("wpa", "0")
+		return
+	case OWE:
+		configureOWE(s)
+		return
+	case OWETransition:
+		ifname := sectionIfname(s)
+		oweIfname := deriveBSSIfname(ifname, "owe")
+
+		// Legacy clients see the open BSS, OWE clients are steered to the hidden one
+		s.Set("wpa", "0")
+		s.Set("owe_transition_ifname", oweIfname)
+
+		b := conf.AddBSS(oweIfname)
+		setSSID(b, oweTransitionSSID(ssid))
+		b.Set("ignore_broadcast_ssid", "1")
+		configureOWE(b)
+		b.Set("owe_transition_ifname", ifname)
+		return
+	}
+
+	s.Set("wpa", "2")
+	s.Set("rsn_pairwise", "CCMP")
+
+	switch mode {
+	case WPA3SAE:
+		s.Set("wpa_key_mgmt", "SAE")
+		setPassphrase(s, password)
+		// PMF is mandatory for WPA3
+		s.Set("ieee80211w", "2")
+		// Allow both hunting-and-pecking and hash-to-element, 6GHz only allows H2E
+		if band == "6" {
+			s.Set("sae_pwe", "1")
+		} else {
+			s.Set("sae_pwe", "2")
+		}
+		s.Set("sae_require_mfp", "1")
+		s.Set("sae_anti_clogging_threshold", saeAntiCloggingThreshold)
+	case WPA2WPA3:
+		s.Set("wpa_key_mgmt", "WPA-PSK SAE")
+		setPassphrase(s, password)
+		// PMF optional so WPA2 clients still connect, but required for SAE clients
+		s.Set("ieee80211w", "1")
+		s.Set("sae_pwe", "2")
+		s.Set("sae_require_mfp", "1")
+		s.Set("sae_anti_clogging_threshold", saeAntiCloggingThreshold)
+	default:
+		s.Set("wpa_key_mgmt", "WPA-PSK")
+		setPassphrase(s, password)
+	}
+}
+
+// validate6GHzSecurity enforces that every 6 GHz BSS uses WPA3 or OWE
+func validate6GHzSecurity(verr *ValidationError, mode SecurityMode) {
+	if mode == "" {
+		mode = WPA2PSK
+	}
+	if !mode.allowedOn6GHz() {
+		verr.add("security", "%s is not allowed on 6 GHz, use %s, %s or %s", mode, WPA3SAE, OWE, WPA3Enterprise)
+	}
+}
+
+// configureOWE writes the settings of an OWE (Enhanced Open) BSS into s
+func configureOWE(s *HostapdSection) {
+	s.Set("wpa", "2")
+	s.Set("wpa_key_mgmt", "OWE")
+	s.Set("rsn_pairwise", "CCMP")
+	// PMF is mandatory for OWE
+	s.Set("ieee80211w", "2")
+}
+
+// oweTransitionSSID derives the hidden OWE SSID from the open one, keeping
+// it within 32 bytes.
+func oweTransitionSSID(ssid string) string {
+	const suffix = "-OWE"
+	for len(ssid)+len(suffix) > 32 {
+		_, size := utf8.DecodeLastRuneInString(ssid)
+		ssid = ssid[:len(ssid)-size]
+	}
+	return ssid + suffix
+}
+
+// sectionIfname returns the interface name of a main or bss= section
+func sectionIfname(s *HostapdSection) string {
+	if ifname, ok := s.Get("bss"); ok {
+		return ifname
+	}
+	ifname, _ := s.Get("interface")
+	return ifname
+}
+
+// deriveBSSIfname builds the name of a virtual BSS interface from the radio
+// interface, keeping it within the 15 character kernel limit.
+func deriveBSSIfname(base, suffix string) string {
+	const maxLen = unix.IFNAMSIZ - 1
+	name := base + "_" + suffix
+	if len(name) > maxLen {
+		// Keep at least one character of base when the suffix is too long
+		if len(suffix) > maxLen-2 {
+			suffix = suffix[:maxLen-2]
+		}
+		cut := min(max(maxLen-len(suffix)-1, 0), len(base))
+		name = base[:cut] + "_" + suffix
+	}
+	return name
+}
+
+// validateSecurity checks that the credentials fit the security mode
+func validateSecurity(verr *ValidationError, password string, mode SecurityMode, enterprise *EnterpriseConfig) {
+	switch mode {
+	case "", WPA2PSK, WPA3SAE, WPA2WPA3, SecurityOpen, OWE, OWETransition, WPA2Enterprise, WPA3Enterprise:
+	default:
+		verr.add("security", "unknown security mode %q", mode)
+		return
+	}
+
+	if mode.isEnterprise() {
+		if password != "" {
+			verr.add("password", "must be empty for %s, users authenticate via 802.1X", mode)
+		}
+		validateEnterprise(verr, enterprise)
+		return
+	}
+
+	if mode.isOpen() {
+		if password != "" {
+			verr.add("password", "must be empty for %s networks", mode)
+		}
+		return
+	}
+
+	validatePassphrase(verr, "password", password)
+
+	if mode.usesSAE() && isHexPSK(password) {
+		verr.add("password", "SAE needs a passphrase, a raw hex PSK can't be used with %s", mode)
+	}
+}
+
+// checkDriverPMFSupport checks if the radio can protect management frames,
+// which OWE and WPA3 require. Without capabilities (info is nil when they
+// couldn't be read) it is assumed supported, hostapd fails if it isn't.
+func checkDriverPMFSupport(info *WiphyInfo) bool {
+	if info == nil {
+		return true
+	}
+	return info.HasCipher(cipherSuiteBIPCMAC)
+}
+
+// checkDriverSAESupport checks if the radio can run an SAE AP, assumed
+// like checkDriverPMFSupport when info is nil
+func checkDriverSAESupport(info *WiphyInfo) bool {
+	if info == nil {
+		return true
+	}
+
+	// SAE requires PMF, which requires BIP-CMAC-128 for management frames
+	if !info.HasCipher(cipherSuiteBIPCMAC) {
+		return false
+	}
+
+	// Drivers doing SAE in firmware advertise it explicitly
+	if info.HasExtFeature(unix.NL80211_EXT_FEATURE_SAE_OFFLOAD_AP) {
+		return true
+	}
+
+	// If the driver lists its AKMs, SAE must be among them. mac80211 drivers
+	// don't list any and leave SAE to hostapd.
+	if len(info.AKMSuites) > 0 {
+		for _, akm := range info.AKMSuites {
+			if akm == akmSuiteSAE {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package pkg
+
+import "testing"
+
+func TestDeriveBSSIfname(t *testing.T) {
+	tests := []struct {
+		base, suffix string
+		want         string
+	}{
+		{"wlan0", "1", "wlan0_1"},
+		{"wlan0", "owe", "wlan0_owe"},
+		{"wlp0s20f3", "owe", "wlp0s20f3_owe"},
+		{"wlx00c0ca123456", "owe", "wlx00c0ca12_owe"},
+		{"wlx00c0ca123456", "2", "wlx00c0ca1234_2"},
+		{"wlan0", "0123456789abcdef", "w_0123456789abc"},
+		{"wlx00c0ca123456", "0123456789abcde", "w_0123456789abc"},
+		{"", "0123456789abcdef", "_0123456789abc"},
+	}
+	for _, tt := range tests {
+		got := deriveBSSIfname(tt.base, tt.suffix)
+		if got != tt.want {
+			t.Errorf("deriveBSSIfname(%q, %q) = %q, want %q", tt.base, tt.suffix, got, tt.want)
+		}
+		if len(got) > 15 {
+			t.Errorf("deriveBSSIfname(%q, %q) = %q, longer than 15 characters", tt.base, tt.suffix, got)
+		}
+	}
+}
@@ -0,0 +1,525 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceState is the health of a supervised process
+type ServiceState string
+
+const (
+	ServiceStarting   ServiceState = "starting"
+	ServiceRunning    ServiceState = "running"
+	ServiceRestarting ServiceState = "restarting" // crashed, started again after the backoff
+	ServiceFailed     ServiceState = "failed"     // crashed too often, not started again
+	ServiceStopped    ServiceState = "stopped"
+)
+
+// RestartPolicy controls how a Supervisor restarts crashed processes,
+// zero fields use the defaults
+type RestartPolicy struct {
+	InitialBackoff time.Duration // delay before the first restart, 1s by default
+	MaxBackoff     time.Duration // the delay doubles after each crash up to this, 30s by default
+	MaxRestarts    int           // crashes within CrashWindow before giving up, 5 by default
+	CrashWindow    time.Duration // a process running this long starts over with InitialBackoff, 1 minute by default
+	OutputLines    int           // lines of output kept for the error report, 50 by default
+}
+
+func (p RestartPolicy) withDefaults() RestartPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = time.Second
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 30 * time.Second
+	}
+	if p.MaxRestarts <= 0 {
+		p.MaxRestarts = 5
+	}
+	if p.CrashWindow <= 0 {
+		p.CrashWindow = time.Minute
+	}
+	if p.OutputLines <= 0 {
+		p.OutputLines = 50
+	}
+	return p
+}
+
+// ServiceHealth is the state of one supervised process
+type ServiceHealth struct {
+	Name       string
+	State      ServiceState
+	PID        int       // 0 when not running
+	Restarts   int       // restarts after crashes
+	Since      time.Time // when State was entered
+	LastError  error     // why the process last exited or failed to start
+	LastOutput []string  // the last lines of output, oldest first
+}
+
+// StartFunc starts a process with its raw output also sent to out, which
+// keeps the last lines for the error report
+type StartFunc func(ctx context.Context, out io.Writer) (*exec.Cmd, error)
+
+// Supervisor owns hostapd and dnsmasq: it starts them, restarts them with
+// an exponential backoff when they crash and stops everything when one
+// keeps crashing.
+type Supervisor struct {
+	policy RestartPolicy
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	ctx      context.Context
+	services []*service
+	hostapd  *service
+	failed   chan error
+	stop     chan struct{}
+	stopping bool
+	watching bool
+
+	// hostapd arguments for restarts after ReconfigureHostapd
+	hostapdIface string
+	hostapdAddr  string
+}
+
+// service is a supervised process
+type service struct {
+	name    string
+	start   StartFunc
+	tail    *tailWriter
+	cmd     *exec.Cmd
+	exited  chan struct{} // closed by watch once cmd exited
+	health  ServiceHealth
+	started time.Time
+	crashes []time.Time
+	backoff time.Duration
+	done    chan struct{}
+
+	// reconfig is closed when a running ReconfigureHostapd finished
+	reconfig chan struct{}
+}
+
+// NewSupervisor creates a supervisor, add processes before calling Start
+func NewSupervisor(policy RestartPolicy) *Supervisor {
+	return &Supervisor{
+		policy: policy.withDefaults(),
+		stop:   make(chan struct{}),
+	}
+}
+
+// SetLogger sets where hostapd and dnsmasq log to when their WifiConfig or
+// DHCPConfig has no Logger, slog.Default() if never set. Call it before Start.
+func (s *Supervisor) SetLogger(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = logger
+}
+
+func (s *Supervisor) processLogger() *slog.Logger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logger
+}
+
+// Add registers a process under name, processes start in the order added
+func (s *Supervisor) Add(name string, start StartFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tail := &tailWriter{max: s.policy.OutputLines}
+	svc := &service{
+		name:   name,
+		start:  start,
+		tail:   tail,
+		health: ServiceHealth{Name: name, State: ServiceStopped},
+		done:   make(chan struct{}),
+	}
+	s.services = append(s.services, svc)
+}
+
+// AddHostapd registers hostapd, see StartHostapd
+func (s *Supervisor) AddHostapd(ifaceName, addrAndMask, ssid, password string, config *WifiConfig) {
+	s.Add("hostapd", s.hostapdStartFunc(ifaceName, addrAndMask, ssid, password, config))
+	s.mu.Lock()
+	s.hostapd = s.services[len(s.services)-1]
+	s.hostapdIface = ifaceName
+	s.hostapdAddr = addrAndMask
+	s.mu.Unlock()
+}
+
+// AddDnsmasq registers dnsmasq, see StartDnsmasq
+func (s *Supervisor) AddDnsmasq(iface string, dhcp *DHCPConfig) {
+	s.Add("dnsmasq", func(ctx context.Context, out io.Writer) (*exec.Cmd, error) {
+		return startDnsmasq(ctx, iface, dhcp, out, s.processLogger())
+	})
+}
+
+func (s *Supervisor) hostapdStartFunc(ifaceName, addrAndMask, ssid, password string, config *WifiConfig) StartFunc {
+	return func(ctx context.Context, out io.Writer) (*exec.Cmd, error) {
+		return startHostapd(ctx, ifaceName, addrAndMask, ssid, password, config, out, s.processLogger())
+	}
+}
+
+// Start starts every process in order and supervises them until ctx is
+// canceled or Stop is called. When one fails to start the processes
+// already started are stopped.
+func (s *Supervisor) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.failed = make(chan error, len(s.services))
+	services := s.services
+	s.mu.Unlock()
+
+	for i, svc := range services {
+		s.mu.Lock()
+		svc.setState(ServiceStarting)
+		svc.started = time.Now()
+		s.mu.Unlock()
+
+		cmd, err := svc.start(ctx, svc.tail)
+		if err != nil {
+			s.mu.Lock()
+			svc.health.LastError = err
+			svc.setState(ServiceFailed)
+			s.mu.Unlock()
+			for j := i - 1; j >= 0; j-- {
+				StopCmd(services[j].cmd)
+			}
+			return fmt.Errorf("start %s: %v%s", svc.name, err, formatOutput(svc.tail.Lines()))
+		}
+
+		s.mu.Lock()
+		svc.setCmd(cmd)
+		svc.setState(ServiceRunning)
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	s.watching = true
+	s.mu.Unlock()
+	for _, svc := range services {
+		go s.watch(ctx, svc)
+	}
+	return nil
+}
+
+// Wait blocks until ctx is canceled, Stop is called or a process crashed
+// too often, then stops every process. It returns the error of the failed
+// process, or an error right away when the supervisor isn't running.
+func (s *Supervisor) Wait() error {
+	s.mu.Lock()
+	ctx, failed, watching := s.ctx, s.failed, s.watching
+	s.mu.Unlock()
+	if !watching {
+		return fmt.Errorf("supervisor is not running, Start was not called or failed")
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case <-s.stop:
+	case err = <-failed:
+	}
+	s.Stop()
+	return err
+}
+
+// Stop stops every process in reverse start order
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return
+	}
+	s.stopping = true
+	close(s.stop)
+	services := s.services
+	watching := s.watching
+	s.mu.Unlock()
+
+	for i := len(services) - 1; i >= 0; i-- {
+		s.mu.Lock()
+		cmd, exited := services[i].cmd, services[i].exited
+		s.mu.Unlock()
+		if !watching {
+			StopCmd(cmd)
+			continue
+		}
+		// watch waits for the process and removes its files
+		if cmd != nil {
+			terminateCmd(cmd)
+			<-exited
+		}
+	}
+	if !watching {
+		return
+	}
+	for _, svc := range services {
+		<-svc.done
+	}
+}
+
+// Health returns the state of every process in start order
+func (s *Supervisor) Health() []ServiceHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	health := make([]ServiceHealth, 0, len(s.services))
+	for _, svc := range s.services {
+		h := svc.health
+		h.LastOutput = svc.tail.Lines()
+		if h.State == ServiceRunning && svc.cmd != nil && svc.cmd.Process != nil {
+			h.PID = svc.cmd.Process.Pid
+		}
+		health = append(health, h)
+	}
+	return health
+}
+
+// ReconfigureHostapd applies a new config to the supervised hostapd, see
+// ReconfigureHostapd. Later restarts after a crash use the new settings.
+func (s *Supervisor) ReconfigureHostapd(ssid, password string, config *WifiConfig) (*ReconfigPlan, error) {
+	s.mu.Lock()
+	svc := s.hostapd
+	if svc == nil || svc.cmd == nil || svc.health.State != ServiceRunning || !s.watching || s.stopping {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("hostapd is not running")
+	}
+	cmd := svc.cmd
+	done := make(chan struct{})
+	svc.reconfig = done
+	s.mu.Unlock()
+
+	newCmd, plan, err := reconfigureHostapd(s.ctx, cmd, ssid, password, config, func(cmd *exec.Cmd) {
+		s.stopReplaced(svc, cmd)
+	})
+
+	s.mu.Lock()
+	if err == nil {
+		svc.start = s.hostapdStartFunc(s.hostapdIface, s.hostapdAddr, ssid, password, config)
+		if newCmd != cmd {
+			svc.setCmd(newCmd)
+			// Stop didn't see the new process
+			if s.stopping {
+				terminateCmd(newCmd)
+			}
+		}
+	}
+	svc.reconfig = nil
+	close(done)
+	s.mu.Unlock()
+	return plan, err
+}
+
+// stopReplaced stops the hostapd that ReconfigureHostapd restarts. watch
+// stays the only one waiting for the process and follows the replacement
+// instead of taking the exit for a crash.
+func (s *Supervisor) stopReplaced(svc *service, cmd *exec.Cmd) {
+	s.mu.Lock()
+	exited := svc.exited
+	s.mu.Unlock()
+	terminateCmd(cmd)
+	<-exited
+	// The new hostapd reuses the runtime files
+	runCleanup(cmd)
+}
+
+// watch restarts the process of svc whenever it exits unexpectedly
+func (s *Supervisor) watch(ctx context.Context, svc *service) {
+	defer close(svc.done)
+
+	s.mu.Lock()
+	cmd, exited := svc.cmd, svc.exited
+	s.mu.Unlock()
+	for {
+		err := cmd.Wait()
+		close(exited)
+
+		s.mu.Lock()
+		// A restart by ReconfigureHostapd replaces the process, follow it
+		if done := svc.reconfig; done != nil {
+			s.mu.Unlock()
+			<-done
+			s.mu.Lock()
+		}
+		if svc.cmd != cmd {
+			cmd, exited = svc.cmd, svc.exited
+			s.mu.Unlock()
+			continue
+		}
+		if s.stopping || ctx.Err() != nil {
+			svc.setState(ServiceStopped)
+			s.mu.Unlock()
+			runCleanup(cmd)
+			return
+		}
+		svc.cmd = nil
+		s.mu.Unlock()
+
+		// Remove the files of the crashed process before it starts again
+		runCleanup(cmd)
+		if err == nil {
+			err = fmt.Errorf("exited unexpectedly")
+		}
+
+		cmd, exited = s.restart(ctx, svc, err)
+		if cmd == nil {
+			return
+		}
+	}
+}
+
+// restart starts the process of svc again after the backoff, until it
+// starts or crashes too often. It returns the process and the channel
+// closed when it exited, nil when svc is given up or the supervisor stops.
+func (s *Supervisor) restart(ctx context.Context, svc *service, err error) (*exec.Cmd, chan struct{}) {
+	for {
+		s.mu.Lock()
+		delay, ok := svc.crash(s.policy, err)
+		if !ok {
+			svc.setState(ServiceFailed)
+			s.mu.Unlock()
+			s.failed <- fmt.Errorf("%s crashed %d times within %s, giving up: %v%s",
+				svc.name, len(svc.crashes), s.policy.CrashWindow, err, formatOutput(svc.health.LastOutput))
+			return nil, nil
+		}
+		svc.setState(ServiceRestarting)
+		s.mu.Unlock()
+		fmt.Printf("WARNING: %s exited (%v), restarting in %s\n", svc.name, err, delay)
+
+		select {
+		case <-ctx.Done():
+		case <-s.stop:
+		case <-time.After(delay):
+		}
+
+		s.mu.Lock()
+		if s.stopping || ctx.Err() != nil {
+			svc.setState(ServiceStopped)
+			s.mu.Unlock()
+			return nil, nil
+		}
+		svc.setState(ServiceStarting)
+		svc.started = time.Now()
+		start := svc.start
+		s.mu.Unlock()
+
+		var cmd *exec.Cmd
+		cmd, err = start(ctx, svc.tail)
+
+		s.mu.Lock()
+		if err == nil && s.stopping {
+			// Stop ran while starting and didn't see this process
+			s.mu.Unlock()
+			StopCmd(cmd)
+			s.mu.Lock()
+			svc.setState(ServiceStopped)
+			s.mu.Unlock()
+			return nil, nil
+		}
+		if err == nil {
+			svc.setCmd(cmd)
+			svc.health.Restarts++
+			svc.setState(ServiceRunning)
+			exited := svc.exited
+			s.mu.Unlock()
+			return cmd, exited
+		}
+		s.mu.Unlock()
+	}
+}
+
+// crash records a crash and returns the delay before the next start, or
+// false once the process crashed more than MaxRestarts times within CrashWindow
+func (svc *service) crash(p RestartPolicy, err error) (time.Duration, bool) {
+	now := time.Now()
+	svc.health.LastError = err
+	svc.health.LastOutput = svc.tail.Lines()
+
+	// A process that ran for a while was fine, start over with the initial backoff
+	if now.Sub(svc.started) >= p.CrashWindow {
+		svc.backoff = 0
+	}
+	recent := svc.crashes[:0]
+	for _, t := range svc.crashes {
+		if now.Sub(t) < p.CrashWindow {
+			recent = append(recent, t)
+		}
+	}
+	svc.crashes = append(recent, now)
+	if len(svc.crashes) > p.MaxRestarts {
+		return 0, false
+	}
+
+	if svc.backoff == 0 {
+		svc.backoff = p.InitialBackoff
+	} else {
+		svc.backoff = min(2*svc.backoff, p.MaxBackoff)
+	}
+	return svc.backoff, true
+}
+
+// setCmd records a started process, watch closes exited once it exited
+func (svc *service) setCmd(cmd *exec.Cmd) {
+	svc.cmd = cmd
+	svc.exited = make(chan struct{})
+}
+
+func (svc *service) setState(state ServiceState) {
+	svc.health.State = state
+	svc.health.Since = time.Now()
+}
+
+// formatOutput appends the last output lines of a process to an error
+func formatOutput(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\nlast output:\n  " + strings.Join(lines, "\n  ")
+}
+
+// tailWriter keeps the last max lines written to it
+type tailWriter struct {
+	mu      sync.Mutex
+	max     int
+	lines   []string
+	partial []byte
+
+	onLine func(line string) // optional, called for every complete line
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.partial = append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(t.partial[:i]), "\r")
+		t.lines = append(t.lines, line)
+		t.partial = t.partial[i+1:]
+		if t.onLine != nil {
+			t.onLine(line)
+		}
+	}
+	if len(t.lines) > t.max {
+		t.lines = append([]string(nil), t.lines[len(t.lines)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+// Lines returns the kept lines, oldest first
+func (t *tailWriter) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := append([]string(nil), t.lines...)
+	if len(t.partial) > 0 {
+		lines = append(lines, string(t.partial))
+	}
+	return lines
+}
@@ -0,0 +1,36 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestSupervisorWaitNotRunning(t *testing.T) {
+	failing := NewSupervisor(RestartPolicy{})
+	failing.Add("broken", func(ctx context.Context, out io.Writer) (*exec.Cmd, error) {
+		return nil, fmt.Errorf("no such binary")
+	})
+	if err := failing.Start(context.Background()); err == nil {
+		t.Fatal("Start succeeded with a failing process")
+	}
+
+	for name, s := range map[string]*Supervisor{
+		"never started": NewSupervisor(RestartPolicy{}),
+		"start failed":  failing,
+	} {
+		done := make(chan error, 1)
+		go func() { done <- s.Wait() }()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("%s: Wait returned nil, want an error", name)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: Wait blocked", name)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes a single invalid field of a WifiConfig or credential
+type FieldError struct {
+	Field  string // e.g. "ssid", "password", "channel"
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Reason)
+}
+
+// ValidationError groups every FieldError found while validating a configuration
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return "invalid wifi configuration: " + strings.Join(msgs, "; ")
+}
+
+// add records a field error
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Errors = append(e.Errors, &FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// merge records the errors of other with their fields prefixed
+func (e *ValidationError) merge(prefix string, other *ValidationError) {
+	for _, fe := range other.Errors {
+		e.Errors = append(e.Errors, &FieldError{Field: prefix + fe.Field, Reason: fe.Reason})
+	}
+}
+
+// err returns nil when nothing was recorded, so callers can return it directly
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// channels24, channels5 and channels6 are the 20 MHz primary channels hostapd accepts per band
+var (
+	channels24 = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14}
+	channels5  = []int{
+		36, 40, 44, 48, 52, 56, 60, 64,
+		100, 104, 108, 112, 116, 120, 124, 128, 132, 136, 140, 144,
+		149, 153, 157, 161, 165, 169, 173, 177,
+	}
+	channels6 = func() []int {
+		var chs []int
+		for ch := 1; ch <= 233; ch += 4 {
+			chs = append(chs, ch)
+		}
+		return chs
+	}()
+
+	// pscChannels6 are the 6 GHz preferred scanning channels clients look at first
+	pscChannels6 = []int{5, 21, 37, 53, 69, 85, 101, 117, 133, 149, 165, 181, 197, 213, 229}
+)
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateWifiConfig checks config, ssid and password before anything is
+// written or any interface is touched. The returned error is a *ValidationError
+// listing every invalid field.
+func ValidateWifiConfig(ssid, password string, config *WifiConfig) error {
+	verr := &ValidationError{}
+
+	validateSSID(verr, "ssid", ssid)
+
+	if config == nil {
+		validateSecurity(verr, password, WPA2PSK, nil)
+	} else {
+		validateRadio(verr, config)
+		validateSecurity(verr, password, config.Security, config.Enterprise)
+		if resolveBand(config) == "6" {
+			validate6GHzSecurity(verr, config.Security)
+		}
+		validateBSSList(verr, config)
+	}
+
+	return verr.err()
+}
+
+// validateSSID checks the SSID length in bytes (not runes)
+func validateSSID(verr *ValidationError, field, ssid string) {
+	if len(ssid) == 0 || len(ssid) > 32 {
+		verr.add(field, "must be 1-32 bytes, got %d", len(ssid))
+	}
+}
+
+// validatePassphrase accepts an 8-63 character ASCII passphrase or a 64 digit hex PSK
+func validatePassphrase(verr *ValidationError, field, password string) {
+	if isHexPSK(password) {
+		return
+	}
+	if len(password) < 8 || len(password) > 63 {
+		verr.add(field, "WPA passphrase must be 8-63 characters or a 64 digit hex PSK, got %d characters", len(password))
+		return
+	}
+	for _, r := range password {
+		if r < 0x20 || r > 0x7e {
+			verr.add(field, "WPA passphrase may only contain printable ASCII characters")
+			return
+		}
+	}
+}
+
+// validateRadio checks standard, band and channel consistency
+func validateRadio(verr *ValidationError, config *WifiConfig) {
+	switch config.Standard {
+	case "", Wifi4, Wifi5, Wifi6, Wifi7:
+	default:
+		verr.add("standard", "unknown wifi standard %q", config.Standard)
+	}
+
+	band := normalizeBand(config.Band)
+	if raw := strings.TrimSpace(strings.ToLower(config.Band)); band == "" && raw != "" && raw != "auto" {
+		verr.add("band", "unknown band %q (use \"2.4\", \"5\" or \"6\")", config.Band)
+	}
+
+	if band == "6" && (config.Standard == Wifi4 || config.Standard == Wifi5) {
+		verr.add("band", "the 6 GHz band requires wifi6 or wifi7")
+	}
+
+	if config.Standard == Wifi5 && resolveBand(config) == "2.4" {
+		verr.add("band", "wifi5 (802.11ac) requires the 5 GHz band")
+	}
+
+	if config.Country != "" && !validCountry(strings.ToUpper(config.Country)) {
+		verr.add("country", "invalid country code %q (use an ISO 3166-1 alpha2 code like \"US\" or \"DE\")", config.Country)
+	}
+	if config.TxPower < 0 || config.TxPower > 36 {
+		verr.add("tx_power", "tx power %d dBm out of range (0-36)", config.TxPower)
+	}
+
+	if !validWidth(config.Width) {
+		verr.add("width", "unsupported channel width %d MHz (use 20, 40, 80, 160 or 320)", config.Width)
+		return
+	}
+	if config.Width == 320 && (band != "6" || config.Standard != Wifi7) {
+		verr.add("width", "320 MHz channels need wifi7 on the 6 GHz band")
+	}
+	if config.Width > 40 && config.Standard == Wifi4 {
+		verr.add("width", "%d MHz channels need wifi5 or wifi6", config.Width)
+	}
+
+	if ch := config.DFSFallbackChannel; ch != 0 && (!containsInt(channels5, ch) || isDFSChannel(ch)) {
+		verr.add("dfs_fallback_channel", "fallback channel %d is not a non-DFS 5 GHz channel", ch)
+	}
+
+	if config.Channel == 0 {
+		return
+	}
+	if !containsInt(channels24, config.Channel) && !containsInt(channels5, config.Channel) &&
+		!containsInt(channels6, config.Channel) {
+		verr.add("channel", "unknown channel %d", config.Channel)
+		return
+	}
+
+	// The channel must belong to the band and fit a block of the requested width
+	band = resolveBand(config)
+	width := config.Width
+	if width == 0 {
+		width = defaultWidth(band, config.Standard)
+	}
+	plan, err := PlanChannel(band, config.Channel, width)
+	if err != nil {
+		verr.add("channel", "%v", err)
+		return
+	}
+	if config.Regulatory != nil {
+		if _, err := config.Regulatory.CheckChannel(plan, config.Standard, config.TxPower); err != nil {
+			verr.add("channel", "%v", err)
+		}
+	}
+}
+
+// isHexPSK reports whether s is a raw 256-bit PSK written as 64 hex digits
+func isHexPSK(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// isPlainSSID reports whether ssid can be written as ssid=<value> without escaping
+func isPlainSSID(ssid string) bool {
+	if ssid != strings.TrimSpace(ssid) {
+		return false
+	}
+	for i := 0; i < len(ssid); i++ {
+		if ssid[i] < 0x20 || ssid[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// setSSID writes the SSID into s, using ssid2 with P"" escaping for UTF-8 and
+// special characters, or hex for arbitrary bytes. This keeps line breaks and
+// other control characters from ever reaching the config file unescaped.
+func setSSID(s *HostapdSection, ssid string) {
+	s.Delete("ssid")
+	s.Delete("ssid2")
+	s.Delete("utf8_ssid")
+
+	if isPlainSSID(ssid) {
+		s.Set("ssid", ssid)
+		return
+	}
+
+	if !utf8.ValidString(ssid) {
+		s.Set("ssid2", fmt.Sprintf("%x", ssid))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`P"`)
+	for i := 0; i < len(ssid); i++ {
+		c := ssid[i]
+		switch {
+		case c == '\\' || c == '"':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteString(`"`)
+	s.Set("ssid2", sb.String())
+	s.Set("utf8_ssid", "1")
+}
+
+// setPassphrase writes a passphrase as wpa_passphrase or a hex PSK as wpa_psk
+func setPassphrase(s *HostapdSection, password string) {
+	s.Delete("wpa_passphrase")
+	s.Delete("wpa_psk")
+	if isHexPSK(password) {
+		s.Set("wpa_psk", strings.ToLower(password))
+		return
+	}
+	s.Set("wpa_passphrase", password)
+}
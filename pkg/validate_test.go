@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetSSID(t *testing.T) {
+	tests := []struct {
+		name     string
+		ssid     string
+		ssid2    string // empty when written as ssid=
+		utf8SSID bool
+	}{
+		{"plain", "Home Network", "", false},
+		{"leading space", " Home", `P" Home"`, true},
+		{"trailing space", "Home ", `P"Home "`, true},
+		{"utf8", "Café ☕", `P"Café ☕"`, true},
+		{"quote and backslash", "a\"b\\cé", `P"a\"b\\c` + "é" + `"`, true},
+		{"newline", "Home\nwpa=0", `P"Home\x0awpa=0"`, true},
+		{"carriage return and del", "a\rb\x7f", `P"a\x0db\x7f"`, true},
+		{"invalid utf8", "\xff\xfeAP", "fffe4150", false},
+	}
+	for _, tt := range tests {
+		s := &HostapdSection{}
+		s.Set("ssid", "old")
+		s.Set("utf8_ssid", "1")
+		setSSID(s, tt.ssid)
+
+		ssid, hasSSID := s.Get("ssid")
+		ssid2, hasSSID2 := s.Get("ssid2")
+		_, hasUTF8 := s.Get("utf8_ssid")
+		if tt.ssid2 == "" {
+			if !hasSSID || ssid != tt.ssid || hasSSID2 {
+				t.Errorf("%s: ssid=%q ssid2=%q, want ssid=%q", tt.name, ssid, ssid2, tt.ssid)
+			}
+		} else if hasSSID || ssid2 != tt.ssid2 {
+			t.Errorf("%s: ssid=%q ssid2=%q, want ssid2=%q", tt.name, ssid, ssid2, tt.ssid2)
+		}
+		if hasUTF8 != tt.utf8SSID {
+			t.Errorf("%s: utf8_ssid set %v, want %v", tt.name, hasUTF8, tt.utf8SSID)
+		}
+		for _, o := range s.Options {
+			if strings.ContainsAny(o.Value, "\r\n") {
+				t.Errorf("%s: %s=%q contains a line break", tt.name, o.Key, o.Value)
+			}
+		}
+	}
+}
+
+func TestValidateWifiConfig(t *testing.T) {
+	hexPSK := strings.Repeat("ab", 32)
+	tests := []struct {
+		name     string
+		ssid     string
+		password string
+		config   *WifiConfig
+		fields   []string // the invalid fields, nil when valid
+	}{
+		{"defaults", "Home", "password123", nil, nil},
+		{"32 byte utf8 ssid", strings.Repeat("é", 16), "password123", nil, nil},
+		{"33 byte ssid", strings.Repeat("a", 33), "password123", nil, []string{"ssid"}},
+		{"empty ssid", "", "password123", nil, []string{"ssid"}},
+		{"short passphrase", "Home", "short", nil, []string{"password"}},
+		{"non ascii passphrase", "Home", "pässword123", nil, []string{"password"}},
+		{"hex psk", "Home", hexPSK, &WifiConfig{Security: WPA2PSK}, nil},
+		{"hex psk with sae", "Home", hexPSK, &WifiConfig{Security: WPA3SAE}, []string{"password"}},
+		{"open with password", "Cafe", "password123", &WifiConfig{Security: SecurityOpen}, []string{"password"}},
+		{"owe", "Cafe", "", &WifiConfig{Security: OWE}, nil},
+		{"unknown standard", "Home", "password123", &WifiConfig{Standard: "wifi8"}, []string{"standard"}},
+		{"unknown band", "Home", "password123", &WifiConfig{Band: "60"}, []string{"band"}},
+		{"wifi5 on 2.4 GHz", "Home", "password123", &WifiConfig{Standard: Wifi5, Band: "2.4"}, []string{"band"}},
+		{"wpa2 on 6 GHz", "Home", "password123", &WifiConfig{Standard: Wifi6, Band: "6"}, []string{"security"}},
+		{"channel outside band", "Home", "password123", &WifiConfig{Band: "5", Channel: 6}, []string{"channel"}},
+		{"320 MHz on wifi6", "Home", "password123", &WifiConfig{Standard: Wifi6, Band: "6", Channel: 37, Width: 320, Security: WPA3SAE}, []string{"width"}},
+		{"bad width", "Home", "password123", &WifiConfig{Width: 60}, []string{"width"}},
+		{"bad country", "Home", "password123", &WifiConfig{Country: "XYZ"}, []string{"country"}},
+		{"bss errors are prefixed", "Home", "password123", &WifiConfig{
+			BSS: []BSSConfig{{SSID: "Guest", Password: "short"}},
+		}, []string{"bss[0].password"}},
+	}
+	for _, tt := range tests {
+		err := ValidateWifiConfig(tt.ssid, tt.password, tt.config)
+		var fields []string
+		if err != nil {
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("%s: error %T is not a *ValidationError", tt.name, err)
+			}
+			for _, fe := range verr.Errors {
+				fields = append(fields, fe.Field)
+			}
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: invalid fields %v, want %v (%v)", tt.name, fields, tt.fields, err)
+		}
+	}
+}